@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/tchenbz/test3AWT/internal/data"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+func (a *applicationDependencies) createAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+		Bio  string `json:"bio"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	author := &data.Author{
+		Name: input.Name,
+		Bio:  input.Bio,
+	}
+
+	v := validator.New()
+	data.ValidateAuthor(v, author)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.authorModel.Insert(author)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAuthor):
+			v.AddError("name", "an author with this name already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/authors/%d", author.ID))
+
+	data := envelope{"author": author}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	author, err := a.authorModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	books, err := a.authorModel.GetBooks(author.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"author": author,
+		"books":  books,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) updateAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	author, err := a.authorModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name *string `json:"name"`
+		Bio  *string `json:"bio"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		author.Name = *input.Name
+	}
+	if input.Bio != nil {
+		author.Bio = *input.Bio
+	}
+
+	v := validator.New()
+	data.ValidateAuthor(v, author)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.authorModel.Update(author)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAuthor):
+			v.AddError("name", "an author with this name already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	a.bookModel.InvalidateAll()
+
+	data := envelope{"author": author}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.authorModel.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrAuthorInUse):
+			a.failedValidationResponse(w, r, map[string]string{"author": "is still credited on one or more books"})
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"message": "author successfully deleted"}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listAuthorsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string
+		data.Filters
+	}
+
+	query := r.URL.Query()
+	input.Name = a.getSingleQueryParameter(query, "name", "")
+	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
+	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
+	input.Filters.Keyset = query.Has("cursor")
+	input.Filters.Cursor = query.Get("cursor")
+	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "name")
+	input.Filters.SortSafeList = []string{"id", "name", "-id", "-name"}
+
+	v := validator.New()
+	data.ValidateFilters(v, input.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	authors, metadata, err := a.authorModel.GetAll(input.Name, input.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"authors":  authors,
+		"metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tchenbz/test3AWT/internal/data"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+// exportFlushEvery controls how many books are written between flushes.
+const exportFlushEvery = 100
+
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	"csv":    {"text/csv; charset=utf-8", "csv"},
+	"ndjson": {"application/x-ndjson", "ndjson"},
+	"bibtex": {"application/x-bibtex; charset=utf-8", "bib"},
+}
+
+func (a *applicationDependencies) exportBooksHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Format string
+		data.BookCriteria
+	}
+
+	v := validator.New()
+
+	query := r.URL.Query()
+	input.Format = a.getSingleQueryParameter(query, "format", "csv")
+	input.Title = a.getSingleQueryParameter(query, "title", "")
+	input.Author = a.getSingleQueryParameter(query, "author", "")
+	input.Genres = a.getCommaSeparatedParameter(query, "genre")
+
+	format, ok := exportFormats[input.Format]
+	v.Check(ok, "format", "must be csv, ndjson or bibtex")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The export can outlive the server-wide write timeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(5 * time.Minute))
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="books.%s"`, format.extension))
+
+	sent := &countingWriter{w: w}
+	buf := bufio.NewWriter(sent)
+	var write func(*data.Book) error
+
+	switch input.Format {
+	case "csv":
+		cw := csv.NewWriter(buf)
+		err := cw.Write([]string{"id", "title", "authors", "isbn", "publication_date", "genre", "description", "average_rating"})
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		write = func(book *data.Book) error {
+			err := cw.Write([]string{
+				strconv.FormatInt(book.ID, 10),
+				book.Title,
+				strings.Join(book.Authors, "; "),
+				book.ISBN,
+				book.Publication.Format("2006-01-02"),
+				book.Genre,
+				book.Description,
+				strconv.FormatFloat(float64(book.AverageRating), 'f', -1, 32),
+			})
+			if err != nil {
+				return err
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+	case "ndjson":
+		enc := json.NewEncoder(buf)
+		write = func(book *data.Book) error {
+			return enc.Encode(book)
+		}
+	case "bibtex":
+		write = func(book *data.Book) error {
+			return writeBibTeX(buf, book)
+		}
+	}
+
+	count := 0
+	err := a.bookModel.Stream(r.Context(), input.BookCriteria, func(book *data.Book) error {
+		err := write(book)
+		if err != nil {
+			return err
+		}
+
+		count++
+		if count%exportFlushEvery == 0 {
+			err = buf.Flush()
+			if err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err != nil {
+		// Until something reaches the client the failure can still be
+		// reported properly. After that the status line has gone out, so
+		// all we can do is log and cut the response short.
+		if sent.n == 0 {
+			w.Header().Del("Content-Disposition")
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		a.logError(r, err)
+	}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func writeBibTeX(w io.Writer, book *data.Book) error {
+	key := book.ISBN
+	if key == "" {
+		key = fmt.Sprintf("book%d", book.ID)
+	}
+
+	authors := make([]string, len(book.Authors))
+	for i, author := range book.Authors {
+		authors[i] = bibtexEscape(author)
+	}
+
+	_, err := fmt.Fprintf(w, "@book{%s,\n  title = {%s},\n  author = {%s},\n  year = {%d},\n  date = {%s},\n  isbn = {%s},\n",
+		key,
+		bibtexEscape(book.Title),
+		strings.Join(authors, " and "),
+		book.Publication.Year(),
+		book.Publication.Format("2006-01-02"),
+		bibtexEscape(book.ISBN),
+	)
+	if err != nil {
+		return err
+	}
+
+	if book.Genre != "" {
+		_, err = fmt.Fprintf(w, "  keywords = {%s},\n", bibtexEscape(book.Genre))
+		if err != nil {
+			return err
+		}
+	}
+	if book.Description != "" {
+		_, err = fmt.Fprintf(w, "  abstract = {%s},\n", bibtexEscape(book.Description))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "}\n\n")
+	return err
+}
+
+var bibtexReplacer = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	"~", `\textasciitilde{}`,
+	"^", `\textasciicircum{}`,
+)
+
+func bibtexEscape(s string) string {
+	return bibtexReplacer.Replace(s)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/tchenbz/test3AWT/internal/data"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+func (a *applicationDependencies) bookHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	revisions, err := a.bookModel.GetRevisions(book.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"book_id":   book.ID,
+		"version":   book.Version,
+		"revisions": revisions,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertBookHandler restores the fields a book had at an earlier version.
+// The revert is saved as a new version, so it can itself be reverted.
+func (a *applicationDependencies) revertBookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	version := a.getSingleIntegerParameter(r.URL.Query(), "version", 0, v)
+	v.Check(version > 0, "version", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !ifMatch(r, etagAt(book.Version, book.UpdatedAt)) {
+		a.preconditionFailedResponse(w, r)
+		return
+	}
+
+	v.Check(int32(version) < book.Version, "version", "must be earlier than the current version")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revision, err := a.bookModel.GetRevision(book.ID, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("version", "no revision with this version exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = revision.Snapshot.Apply(book)
+	if err != nil {
+		a.serverErrorResponse(w, r, fmt.Errorf("revision %d of book %d: %w", version, book.ID, err))
+		return
+	}
+
+	data.ValidateBook(v, book)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.bookModel.Update(book, a.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateISBN):
+			v.AddError("isbn", "another book now uses this ISBN")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownAuthor):
+			v.AddError("contributors", "references an author that no longer exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"book": book}
+	err = a.writeJSON(w, http.StatusOK, data, modifiedHeaders(book.Version, book.UpdatedAt))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tchenbz/test3AWT/internal/data"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+const maxImportBytes = 20_000_000
+
+// importRow is one book as it appears in an import file, before validation.
+type importRow struct {
+	Title       string   `json:"title"`
+	Authors     []string `json:"authors"`
+	ISBN        string   `json:"isbn"`
+	Publication string   `json:"publication_date"`
+	Genre       string   `json:"genre"`
+	Description string   `json:"description"`
+}
+
+func (a *applicationDependencies) importBooksHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	query := r.URL.Query()
+	dryRun := a.getSingleBooleanParameter(query, "dry_run", false, v)
+	atomic := a.getSingleBooleanParameter(query, "atomic", false, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/csv" && mediaType != "application/x-ndjson") {
+		a.unsupportedMediaTypeResponse(w, r, "text/csv", "application/x-ndjson")
+		return
+	}
+
+	// Large catalogs take longer than the server-wide timeouts allow
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(2 * time.Minute))
+	_ = rc.SetWriteDeadline(time.Now().Add(2 * time.Minute))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var rows []importRow
+	var results []*data.ImportResult
+
+	if mediaType == "text/csv" {
+		rows, results, err = a.readImportCSV(r.Body)
+	} else {
+		rows, results, err = a.readImportNDJSON(r.Body)
+	}
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("the body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	books := make([]*data.Book, len(rows))
+	for i, row := range rows {
+		if results[i].Status == data.ImportRejected {
+			continue
+		}
+
+		book, errs := a.importRowToBook(row)
+		results[i].ISBN = book.ISBN
+		if errs != nil {
+			results[i].Status = data.ImportRejected
+			results[i].Errors = errs
+			continue
+		}
+		books[i] = book
+	}
+
+	report, err := a.bookModel.Import(books, results, atomic, dryRun, a.contextGetUser(r).ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"import": report}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) importRowToBook(row importRow) (*data.Book, map[string]string) {
+	book := &data.Book{
+		Title:       row.Title,
+		Authors:     row.Authors,
+		ISBN:        row.ISBN,
+		Genre:       row.Genre,
+		Description: row.Description,
+	}
+
+	v := validator.New()
+
+	if row.Publication != "" {
+		parsedDate, err := time.Parse("2006-01-02", row.Publication)
+		if err != nil {
+			v.AddError("publication_date", "must be a valid date in YYYY-MM-DD format")
+		}
+		book.Publication = parsedDate
+	}
+
+	data.ValidateBook(v, book)
+	if !v.IsEmpty() {
+		return book, v.Errors
+	}
+
+	return book, nil
+}
+
+// readImportCSV reads a CSV file with a header row naming the columns. Multiple
+// authors share one cell, separated by semicolons.
+func (a *applicationDependencies) readImportCSV(body io.Reader) ([]importRow, []*data.ImportResult, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, errors.New("the body must not be empty")
+		}
+		return nil, nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"title", "authors", "isbn", "publication_date"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("the CSV header must include a %q column", required)
+		}
+	}
+
+	var rows []importRow
+	var results []*data.ImportResult
+
+	for n := 1; ; n++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		result := &data.ImportResult{Row: n}
+		results = append(results, result)
+		rows = append(rows, importRow{})
+
+		if err != nil {
+			var parseError *csv.ParseError
+			if !errors.As(err, &parseError) {
+				return nil, nil, err
+			}
+			result.Status = data.ImportRejected
+			result.Errors = map[string]string{"row": parseError.Err.Error()}
+			continue
+		}
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row := importRow{
+			Title:       field("title"),
+			ISBN:        field("isbn"),
+			Publication: field("publication_date"),
+			Genre:       field("genre"),
+			Description: field("description"),
+		}
+		for _, author := range strings.Split(field("authors"), ";") {
+			author = strings.TrimSpace(author)
+			if author != "" {
+				row.Authors = append(row.Authors, author)
+			}
+		}
+		rows[len(rows)-1] = row
+	}
+
+	return rows, results, nil
+}
+
+// readImportNDJSON reads one JSON book object per line, skipping blank lines.
+func (a *applicationDependencies) readImportNDJSON(body io.Reader) ([]importRow, []*data.ImportResult, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1_000_000)
+
+	var rows []importRow
+	var results []*data.ImportResult
+
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var row importRow
+		result := &data.ImportResult{Row: n}
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&row)
+		if err != nil {
+			result.Status = data.ImportRejected
+			result.Errors = map[string]string{"row": err.Error()}
+		}
+
+		rows = append(rows, row)
+		results = append(results, result)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil, errors.New("the body must not be empty")
+	}
+
+	return rows, results, nil
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/julienschmidt/httprouter"
 	"github.com/tchenbz/test3AWT/internal/data"
 	"github.com/tchenbz/test3AWT/internal/validator"
 )
@@ -18,6 +19,9 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 		Publication string   `json:"publication_date"`
 		Genre       string   `json:"genre"`
 		Description string   `json:"description"`
+		Format      string   `json:"format"`
+		Language    string   `json:"language"`
+		Contributors []data.Contributor `json:"contributors"`
 	}
 
 	err := a.readJSON(w, r, &input)
@@ -39,6 +43,9 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
         Publication: parsedDate, 
 		Genre:       input.Genre,
 		Description: input.Description,
+		Format:      input.Format,
+		Language:    input.Language,
+		Contributors: input.Contributors,
 	}
 
 	v := validator.New()
@@ -48,13 +55,22 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	err = a.bookModel.Insert(book)
+	err = a.bookModel.Insert(book, a.contextGetUser(r).ID)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateISBN):
+			v.AddError("isbn", "a book with this ISBN already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownAuthor):
+			v.AddError("contributors", "references an author that does not exist")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	headers := make(http.Header)
+	headers := modifiedHeaders(book.Version, book.UpdatedAt)
 	headers.Set("Location", fmt.Sprintf("/api/v1/books/%d", book.ID))
 
 	data := envelope{"book": book}
@@ -83,7 +99,36 @@ func (a *applicationDependencies) displayBookHandler(w http.ResponseWriter, r *h
 	}
 
 	data := envelope{"book": book}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeCacheableJSON(w, r, data, modifiedHeaders(book.Version, book.UpdatedAt))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayBookByISBNHandler(w http.ResponseWriter, r *http.Request) {
+	isbn := httprouter.ParamsFromContext(r.Context()).ByName("isbn")
+
+	v := validator.New()
+	_, ok := data.NormalizeISBN(isbn)
+	v.Check(ok, "isbn", "must be a valid ISBN-10 or ISBN-13")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book, err := a.bookModel.GetByISBN(isbn)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"book": book}
+	err = a.writeCacheableJSON(w, r, data, modifiedHeaders(book.Version, book.UpdatedAt))
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -107,6 +152,11 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
         return
     }
 
+    if !ifMatch(r, etagAt(book.Version, book.UpdatedAt)) {
+        a.preconditionFailedResponse(w, r)
+        return
+    }
+
     var input struct {
         Title       *string   `json:"title"`
         Authors     *[]string `json:"authors"`
@@ -114,6 +164,9 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
         Publication *string   `json:"publication_date"` 
         Genre       *string   `json:"genre"`
         Description *string   `json:"description"`
+        Format      *string   `json:"format"`
+        Language    *string   `json:"language"`
+        Contributors *[]data.Contributor `json:"contributors"`
     }
 
     err = a.readJSON(w, r, &input)
@@ -127,6 +180,11 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
     }
     if input.Authors != nil {
         book.Authors = *input.Authors
+        // Rebuild the author credits from the names, keeping other roles
+        book.Contributors = nil
+    }
+    if input.Contributors != nil {
+        book.Contributors = *input.Contributors
     }
     if input.ISBN != nil {
         book.ISBN = *input.ISBN
@@ -145,6 +203,12 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
     if input.Description != nil {
         book.Description = *input.Description
     }
+    if input.Format != nil {
+        book.Format = *input.Format
+    }
+    if input.Language != nil {
+        book.Language = *input.Language
+    }
 
     v := validator.New()
     data.ValidateBook(v, book)
@@ -153,14 +217,25 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
         return
     }
 
-    err = a.bookModel.Update(book)
+    err = a.bookModel.Update(book, a.contextGetUser(r).ID)
     if err != nil {
-        a.serverErrorResponse(w, r, err)
+        switch {
+        case errors.Is(err, data.ErrDuplicateISBN):
+            v.AddError("isbn", "a book with this ISBN already exists")
+            a.failedValidationResponse(w, r, v.Errors)
+        case errors.Is(err, data.ErrUnknownAuthor):
+            v.AddError("contributors", "references an author that does not exist")
+            a.failedValidationResponse(w, r, v.Errors)
+        case errors.Is(err, data.ErrEditConflict):
+            a.editConflictResponse(w, r)
+        default:
+            a.serverErrorResponse(w, r, err)
+        }
         return
     }
 
     data := envelope{"book": book}
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.writeJSON(w, http.StatusOK, data, modifiedHeaders(book.Version, book.UpdatedAt))
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
@@ -173,11 +248,31 @@ func (a *applicationDependencies) deleteBookHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	err = a.bookModel.Delete(id)
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !ifMatch(r, etagAt(book.Version, book.UpdatedAt)) {
+		a.preconditionFailedResponse(w, r)
+		return
+	}
+
+	// The delete only applies to the version read above, so a change made
+	// after the If-Match check is reported as a conflict
+	err = a.bookModel.Delete(book.ID, book.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
 		default:
 			a.serverErrorResponse(w, r, err)
 		}
@@ -193,46 +288,112 @@ func (a *applicationDependencies) deleteBookHandler(w http.ResponseWriter, r *ht
 
 func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Author string
-		Genre  string
+		data.BookCriteria
+		Match  string
+		Facets []string
 		data.Filters
 	}
 
+	v := validator.New()
+
 	query := r.URL.Query()
 	input.Title = a.getSingleQueryParameter(query, "title", "")
 	input.Author = a.getSingleQueryParameter(query, "author", "")
-	input.Genre = a.getSingleQueryParameter(query, "genre", "")
+	input.Genres = a.getCommaSeparatedParameter(query, "genre")
+	input.PublishedAfter = a.getSingleDateParameter(query, "published_after", v)
+	input.PublishedBefore = a.getSingleDateParameter(query, "published_before", v)
+	input.Match = a.getSingleQueryParameter(query, "match", "exact")
+	input.Facets = a.getCommaSeparatedParameter(query, "facets")
 	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
 	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
-	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
-	input.Filters.SortSafeList = []string{"id", "title", "genre", "authors", "-id", "-title", "-genre", "-authors"}
+	input.Filters.Keyset = query.Has("cursor")
+	input.Filters.Cursor = query.Get("cursor")
+	input.Filters.SortSafeList = []string{"id", "title", "genre", "authors", "average_rating", "weighted_rating",
+		"-id", "-title", "-genre", "-authors", "-average_rating", "-weighted_rating"}
+
+	input.Fuzzy = input.Match == "fuzzy"
+	if input.Fuzzy {
+		input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "-similarity")
+		input.Filters.SortSafeList = append(input.Filters.SortSafeList, "similarity", "-similarity")
+	} else {
+		input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
+	}
 
-	v := validator.New()
+	v.Check(validator.PermittedValue(input.Match, "exact", "fuzzy"), "match", "must be exact or fuzzy")
+	v.Check(!(input.Fuzzy && input.Filters.Keyset), "cursor", "is not supported with match=fuzzy")
+	for _, facet := range input.Facets {
+		v.Check(validator.PermittedValue(facet, data.FacetSafeList...), "facets", "must only contain genre, author, decade or rating_bucket")
+	}
+	if !input.PublishedAfter.IsZero() && !input.PublishedBefore.IsZero() {
+		v.Check(!input.PublishedAfter.After(input.PublishedBefore), "published_after", "must not be later than published_before")
+	}
 	data.ValidateFilters(v, input.Filters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	books, metadata, err := a.bookModel.GetAll(input.Title, input.Author, input.Genre, input.Filters)
+	var env envelope
+
+	if input.Fuzzy {
+		results, err := a.fuzzyBookResults(input.BookCriteria, input.Filters)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		env = results
+	} else {
+		books, metadata, err := a.bookModel.GetAll(input.BookCriteria, input.Filters)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		env = envelope{
+			"books":    books,
+			"metadata": metadata,
+		}
+	}
+
+	if len(input.Facets) > 0 {
+		facets, err := a.bookModel.Facets(input.BookCriteria, input.Facets)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		env["facets"] = facets
+	}
+
+	err := a.writeCacheableJSON(w, r, env, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
-		return
 	}
+}
 
-	data := envelope{
-		"books":    books,
+func (a *applicationDependencies) fuzzyBookResults(criteria data.BookCriteria, filters data.Filters) (envelope, error) {
+	matches, metadata, err := a.bookModel.GetAllFuzzy(criteria, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	env := envelope{
+		"results":  matches,
 		"metadata": metadata,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
-	if err != nil {
-		a.serverErrorResponse(w, r, err)
+
+	if len(matches) == 0 {
+		suggestions, err := a.bookModel.Suggest(criteria.Title, criteria.Author)
+		if err != nil {
+			return nil, err
+		}
+		env["suggestions"] = suggestions
 	}
+
+	return env, nil
 }
 
 func (a *applicationDependencies) searchBooksHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
+		Q      string
 		Title  string
 		Author string
 		Genre  string
@@ -240,13 +401,21 @@ func (a *applicationDependencies) searchBooksHandler(w http.ResponseWriter, r *h
 	}
 
 	query := r.URL.Query()
+	input.Q = a.getSingleQueryParameter(query, "q", "")
 	input.Title = a.getSingleQueryParameter(query, "title", "")
 	input.Author = a.getSingleQueryParameter(query, "author", "")
 	input.Genre = a.getSingleQueryParameter(query, "genre", "")
 	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
 	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
-	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
-	input.Filters.SortSafeList = []string{"id", "title", "genre", "authors", "-id", "-title", "-genre", "-authors"}
+
+	// Without a q= term fall back to the plain title/author/genre listing
+	if input.Q == "" {
+		input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
+		input.Filters.SortSafeList = []string{"id", "title", "genre", "authors", "-id", "-title", "-genre", "-authors"}
+	} else {
+		input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "-relevance")
+		input.Filters.SortSafeList = []string{"relevance", "id", "title", "genre", "-relevance", "-id", "-title", "-genre"}
+	}
 
 	v := validator.New()
 	data.ValidateFilters(v, input.Filters)
@@ -255,17 +424,40 @@ func (a *applicationDependencies) searchBooksHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	books, metadata, err := a.bookModel.GetAll(input.Title, input.Author, input.Genre, input.Filters)
+	if input.Q == "" {
+		criteria := data.BookCriteria{Title: input.Title, Author: input.Author}
+		if input.Genre != "" {
+			criteria.Genres = []string{input.Genre}
+		}
+
+		books, metadata, err := a.bookModel.GetAll(criteria, input.Filters)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		data := envelope{
+			"books":    books,
+			"metadata": metadata,
+		}
+		err = a.writeCacheableJSON(w, r, data, nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	results, metadata, err := a.bookModel.Search(input.Q, input.Genre, input.Filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
 	data := envelope{
-		"books":    books,
+		"results":  results,
 		"metadata": metadata,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeCacheableJSON(w, r, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/tchenbz/test3AWT/internal/data"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+func (a *applicationDependencies) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	review, ok := a.commentReview(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Content  string `json:"content"`
+		ParentID *int64 `json:"parent_id"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment := &data.Comment{
+		ReviewID: review.ID,
+		ParentID: input.ParentID,
+		UserID:   user.ID,
+		Author:   user.Username,
+		Content:  input.Content,
+	}
+
+	v := validator.New()
+	data.ValidateComment(v, comment)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.commentModel.Insert(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownParent):
+			v.AddError("parent_id", "no comment with this id exists on this review")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"comment": comment}
+	err = a.writeJSON(w, http.StatusCreated, data, modifiedHeaders(comment.Version, comment.UpdatedAt))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.commentReview(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	query := r.URL.Query()
+	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
+	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 20, validator.New())
+	input.Filters.Keyset = query.Has("cursor")
+	input.Filters.Cursor = query.Get("cursor")
+	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
+	input.Filters.SortSafeList = []string{"id", "created_at", "-id", "-created_at"}
+
+	v := validator.New()
+	data.ValidateFilters(v, input.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comments, metadata, err := a.commentModel.GetThreads(review.ID, input.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"comments": comments,
+		"metadata": metadata,
+	}
+	err = a.writeCacheableJSON(w, r, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, ok := a.ownComment(w, r)
+	if !ok {
+		return
+	}
+
+	if !ifMatch(r, etagAt(comment.Version, comment.UpdatedAt)) {
+		a.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Content *string `json:"content"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Content != nil {
+		comment.Content = *input.Content
+	}
+
+	v := validator.New()
+	data.ValidateComment(v, comment)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.commentModel.Update(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"comment": comment}
+	err = a.writeJSON(w, http.StatusOK, data, modifiedHeaders(comment.Version, comment.UpdatedAt))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, ok := a.ownComment(w, r)
+	if !ok {
+		return
+	}
+
+	if !ifMatch(r, etagAt(comment.Version, comment.UpdatedAt)) {
+		a.preconditionFailedResponse(w, r)
+		return
+	}
+
+	err := a.commentModel.Delete(comment.ID, comment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"message": "comment successfully deleted"}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// commentReview loads the review named in the URL, writing a 404 if it does
+// not exist or the user may not see it. Comments on deleted reviews are
+// unreachable.
+func (a *applicationDependencies) commentReview(w http.ResponseWriter, r *http.Request) (*data.Review, bool) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	review, err := a.reviewModel.Get(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !a.canSeeReview(r, review) {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return review, true
+}
+
+// ownComment loads the comment named in the URL and checks that it belongs
+// to the review in the URL and was written by the current user.
+func (a *applicationDependencies) ownComment(w http.ResponseWriter, r *http.Request) (*data.Comment, bool) {
+	review, ok := a.commentReview(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	commentID, err := a.readIDParamNamed(r, "comment_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	comment, err := a.commentModel.Get(commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if comment.ReviewID != review.ID {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	if comment.UserID != a.contextGetUser(r).ID {
+		a.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return comment, true
+}
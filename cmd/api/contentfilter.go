@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/tchenbz/test3AWT/internal/contentfilter"
+	"github.com/tchenbz/test3AWT/internal/data"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+const blockedMessage = "contains language that is not allowed"
+
+// screenText runs text through the content filter. Rejected text is reported
+// on v under key and masked words are replaced in place. It reports whether
+// the filter wants a moderator to see the text.
+func (a *applicationDependencies) screenText(v *validator.Validator, key string, text *string) bool {
+	result := a.screener.Screen(*text)
+
+	switch result.Action {
+	case contentfilter.Reject:
+		v.AddError(key, blockedMessage)
+	case contentfilter.Mask, contentfilter.Moderate:
+		*text = result.Text
+	}
+
+	return result.Action == contentfilter.Moderate
+}
+
+// screenReview screens a review's content, holding it for moderation if the
+// filter asks for that.
+func (a *applicationDependencies) screenReview(v *validator.Validator, review *data.Review) {
+	review.Held = a.screenText(v, "content", &review.Content)
+}
+
+// screenReadingList screens a list's name and description. Lists have no
+// moderation queue, so text that would be held is rejected instead.
+func (a *applicationDependencies) screenReadingList(v *validator.Validator, list *data.ReadingList) {
+	if a.screenText(v, "name", &list.Name) {
+		v.AddError("name", blockedMessage)
+	}
+	if a.screenText(v, "description", &list.Description) {
+		v.AddError("description", blockedMessage)
+	}
+}
+
+// startBlocklistWatcher rereads the blocklist file whenever it changes,
+// checking at the configured interval. Without a blocklist it does nothing.
+func (a *applicationDependencies) startBlocklistWatcher(blocklist *contentfilter.Blocklist) {
+	if blocklist == nil || a.config.blocklist.poll <= 0 {
+		return
+	}
+
+	a.runPeriodically(a.config.blocklist.poll, func() {
+		reloaded, err := blocklist.Reload()
+		if err != nil {
+			a.logger.Error("failed to reload blocklist", "error", err)
+		} else if reloaded {
+			a.logger.Info("reloaded blocklist", "rules", blocklist.Len())
+		}
+	})
+}
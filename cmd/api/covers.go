@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tchenbz/test3AWT/internal/cover"
+	"github.com/tchenbz/test3AWT/internal/data"
+	"github.com/tchenbz/test3AWT/internal/storage"
+)
+
+// uploadBookCoverHandler takes the raw image as the request body. It has its
+// own size limit, as readJSON's 256KB cap is far too small for images.
+func (a *applicationDependencies) uploadBookCoverHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !slices.Contains(cover.ContentTypes, mediaType) {
+		a.unsupportedMediaTypeResponse(w, r, cover.ContentTypes...)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, a.config.cover.maxBytes)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("the body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	images, hash, err := cover.Process(body)
+	if err != nil {
+		switch {
+		case errors.Is(err, cover.ErrUnsupportedType):
+			a.unsupportedMediaTypeResponse(w, r, cover.ContentTypes...)
+		case errors.Is(err, cover.ErrInvalidImage):
+			a.failedValidationResponse(w, r, map[string]string{"cover": "must be a valid JPEG, PNG or WebP image"})
+		case errors.Is(err, cover.ErrTooLarge):
+			a.failedValidationResponse(w, r, map[string]string{"cover": fmt.Sprintf("must not have more than %d pixels", cover.MaxPixels)})
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for size, image := range images {
+		err = a.store.Put(data.CoverKey(book.ID, hash, size), image)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = a.bookModel.SetCover(book.ID, hash)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The old files are only unreachable once the new hash is saved
+	if book.CoverHash != "" && book.CoverHash != hash {
+		for _, size := range cover.Sizes {
+			err = a.store.Delete(data.CoverKey(book.ID, book.CoverHash, size.Name))
+			if err != nil {
+				a.logger.Error("failed to delete old cover", "book_id", book.ID, "error", err)
+			}
+		}
+	}
+	book.CoverHash = hash
+
+	data := envelope{"book": book}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// displayBookCoverHandler serves one size of a book's cover. It needs no
+// authentication, so the URLs work in plain <img> tags. Requests carrying
+// the current hash in ?v= may be cached for good.
+func (a *applicationDependencies) displayBookCoverHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	size := httprouter.ParamsFromContext(r.Context()).ByName("size")
+	if !cover.IsSize(size) {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if book.CoverHash == "" {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	object, err := a.store.Get(data.CoverKey(book.ID, book.CoverHash, size))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer object.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%s"`, book.CoverHash, size))
+	if r.URL.Query().Get("v") == book.CoverHash {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	}
+
+	http.ServeContent(w, r, "", object.ModTime, object)
+}
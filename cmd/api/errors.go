@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 func (a *applicationDependencies)logError(r *http.Request, err error) {
@@ -79,4 +80,24 @@ func (a *applicationDependencies) notPermittedResponse(w http.ResponseWriter, r
 func (a *applicationDependencies) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	a.errorResponseJSON(w, r, http.StatusUnauthorized, message)
-}
\ No newline at end of file
+}
+
+func (a *applicationDependencies) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, supported ...string) {
+	message := fmt.Sprintf("the Content-Type must be one of: %s", strings.Join(supported, ", "))
+	a.errorResponseJSON(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func (a *applicationDependencies) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has changed since you last retrieved it, please fetch it again"
+	a.errorResponseJSON(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (a *applicationDependencies) ownReviewResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you cannot vote on or report your own review"
+	a.errorResponseJSON(w, r, http.StatusForbidden, message)
+}
+
+func (a *applicationDependencies) reviewRemovedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your review of this book was removed by a moderator and cannot be replaced"
+	a.errorResponseJSON(w, r, http.StatusConflict, message)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/tchenbz/test3AWT/internal/validator"
@@ -100,6 +102,18 @@ func (a *applicationDependencies)readIDParam(r *http.Request)(int64, error) {
 
 }
 
+// readIDParamNamed reads a positive id from a named route parameter other
+// than "id", such as the book in /v1/works/:id/editions/:book_id.
+func (a *applicationDependencies) readIDParamNamed(r *http.Request, name string) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+
+	return id, nil
+}
+
 func (a *applicationDependencies) getSingleQueryParameter(queryParameters url.Values, key string, defaultValue string) string {
 	result := queryParameters.Get(key)
 	if result == "" {
@@ -124,6 +138,54 @@ func (a *applicationDependencies) getSingleIntegerParameter(queryParameters url.
 	return intValue
 }
 
+func (a *applicationDependencies) getSingleBooleanParameter(queryParameters url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	result := queryParameters.Get(key)
+
+	if result == "" {
+		return defaultValue
+	}
+
+	boolValue, err := strconv.ParseBool(result)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return boolValue
+}
+
+func (a *applicationDependencies) getCommaSeparatedParameter(queryParameters url.Values, key string) []string {
+	result := queryParameters.Get(key)
+	if result == "" {
+		return nil
+	}
+
+	values := []string{}
+	for _, value := range strings.Split(result, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func (a *applicationDependencies) getSingleDateParameter(queryParameters url.Values, key string, v *validator.Validator) time.Time {
+	result := queryParameters.Get(key)
+	if result == "" {
+		return time.Time{}
+	}
+
+	date, err := time.Parse("2006-01-02", result)
+	if err != nil {
+		v.AddError(key, "must be a valid date in YYYY-MM-DD format")
+		return time.Time{}
+	}
+
+	return date
+}
+
 func (a *applicationDependencies) background(fn func()) {
     a.wg.Add(1) 
     go func() {
@@ -137,3 +199,147 @@ func (a *applicationDependencies) background(fn func()) {
        fn()
    }()
 }
+
+// runPeriodically runs fn in the background straight away and then at every
+// interval until the server starts shutting down. A run in progress at
+// shutdown is allowed to finish.
+func (a *applicationDependencies) runPeriodically(interval time.Duration, fn func()) {
+	a.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			fn()
+
+			select {
+			case <-a.shutdown:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// etag derives a strong entity tag from a record's version.
+func etag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// etagAt derives the entity tag of a record whose representation can change
+// without its version moving, such as a book gaining a cover or a rating.
+func etagAt(version int32, modified time.Time) string {
+	return fmt.Sprintf(`"%d-%x"`, version, modified.UnixMicro())
+}
+
+// versionHeaders returns response headers carrying the ETag for version.
+func versionHeaders(version int32) http.Header {
+	headers := make(http.Header)
+	headers.Set("ETag", etag(version))
+	return headers
+}
+
+// modifiedHeaders returns response headers carrying the ETag and
+// Last-Modified validators of a record.
+func modifiedHeaders(version int32, modified time.Time) http.Header {
+	headers := make(http.Header)
+	headers.Set("ETag", etagAt(version, modified))
+	headers.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	return headers
+}
+
+// ifMatch reports whether the request's If-Match precondition holds for a
+// record whose current ETag is current. A request without If-Match always
+// matches. Weak tags never match, as If-Match uses strong comparison.
+func ifMatch(r *http.Request, current string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified reports whether the client already holds the representation
+// described by the ETag and Last-Modified in headers. If-None-Match takes
+// precedence over If-Modified-Since and uses weak comparison.
+func notModified(r *http.Request, headers http.Header) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		current := strings.TrimPrefix(headers.Get("ETag"), "W/")
+		if current == "" {
+			return false
+		}
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == current {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(headers.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// writeCacheableJSON sends a read-only GET response. Anonymous responses,
+// which only public routes such as the book search can produce, may be
+// cached by shared caches for a minute; authenticated ones only by the
+// client, which must revalidate them each time. When headers carry no ETag,
+// a weak one is derived from the body, so lists get a validator covering
+// their rows, metadata and any facets. Clients holding a current copy get a
+// bodiless 304 Not Modified.
+func (a *applicationDependencies) writeCacheableJSON(w http.ResponseWriter, r *http.Request, data envelope, headers http.Header) error {
+	if headers == nil {
+		headers = make(http.Header)
+	}
+
+	if a.contextGetUser(r).IsAnonymous() {
+		headers.Set("Cache-Control", "public, max-age=60")
+	} else {
+		headers.Set("Cache-Control", "private, no-cache")
+	}
+
+	var js []byte
+	if headers.Get("ETag") == "" {
+		var err error
+		js, err = json.MarshalIndent(data, "", "\t")
+		if err != nil {
+			return err
+		}
+		js = append(js, '\n')
+
+		sum := sha256.Sum256(js)
+		headers.Set("ETag", fmt.Sprintf(`W/"%x"`, sum[:16]))
+	}
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	if notModified(r, headers) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	if js == nil {
+		return a.writeJSON(w, http.StatusOK, data, nil)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(js)
+	return err
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"expvar"
 	"flag"
 
 	//"log"
@@ -13,8 +15,11 @@ import (
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/tchenbz/test3AWT/internal/cache"
+	"github.com/tchenbz/test3AWT/internal/contentfilter"
 	"github.com/tchenbz/test3AWT/internal/data"
 	"github.com/tchenbz/test3AWT/internal/mailer"
+	"github.com/tchenbz/test3AWT/internal/storage"
 )
 
 const appVersion = "1.0.0"
@@ -40,19 +45,51 @@ type serverConfig struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	cursor struct {
+		secret string
+	}
+	storage struct {
+		dir string
+	}
+	cover struct {
+		maxBytes int64
+	}
+	trash struct {
+		retention time.Duration
+	}
+	revisions struct {
+		retention time.Duration
+	}
+	cache struct {
+		size int
+		ttl  time.Duration
+	}
+	blocklist struct {
+		path string
+		poll time.Duration
+	}
 }
 
 type applicationDependencies struct {
 	config           serverConfig
 	logger           *slog.Logger
-	bookModel        data.BookModel
+	bookModel        data.CachedBookModel
+	authorModel      data.AuthorModel
+	workModel        data.WorkModel
+	seriesModel      data.SeriesModel
+	trashModel       data.TrashModel
 	readingListModel data.ReadingListModel
 	reviewModel      data.ReviewModel
+	commentModel     data.CommentModel
+	moderationModel  data.ModerationModel
 	userModel        data.UserModel
 	mailer           mailer.Mailer
 	wg               sync.WaitGroup
+	shutdown         chan struct{}
 	tokenModel       data.TokenModel
-	permissionModel  data.PermissionModel
+	permissionModel  data.CachedPermissionModel
+	store            storage.Store
+	screener         contentfilter.Screener
 }
 
 func main() {
@@ -70,6 +107,17 @@ func main() {
 	flag.StringVar(&settings.smtp.password, "smtp-password", "d72ca97563008b", "SMTP password")
 	flag.StringVar(&settings.smtp.sender, "smtp-sender", "Comments Community <no-reply@commentscommunity.tamikachen.net>", "SMTP sender")
 
+	flag.StringVar(&settings.cursor.secret, "cursor-secret", os.Getenv("TEST3_CURSOR_SECRET"), "Secret for signing pagination cursors (random per process if empty)")
+
+	flag.StringVar(&settings.storage.dir, "storage-dir", "./uploads", "Directory for uploaded files such as book covers")
+	flag.Int64Var(&settings.cover.maxBytes, "cover-max-bytes", 5_000_000, "Maximum size of a cover image upload in bytes")
+	flag.IntVar(&settings.cache.size, "cache-size", 1000, "Maximum number of entries in each in-process cache (0 disables caching)")
+	flag.DurationVar(&settings.cache.ttl, "cache-ttl", 30*time.Second, "How long cached books and permissions are served before being reloaded")
+	flag.StringVar(&settings.blocklist.path, "blocklist", "", "File of content filter rules applied to reviews and reading lists (empty disables filtering)")
+	flag.DurationVar(&settings.blocklist.poll, "blocklist-poll", 10*time.Second, "How often the blocklist file is checked for changes (0 disables reloading)")
+	flag.DurationVar(&settings.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted items stay restorable before they are purged (0 keeps them forever)")
+	flag.DurationVar(&settings.revisions.retention, "revision-retention", 365*24*time.Hour, "How long earlier versions of edited reviews are kept (0 keeps them forever)")
+
 	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)",
 		func(val string) error {
 			settings.cors.trustedOrigins = strings.Fields(val)
@@ -80,6 +128,24 @@ func main() {
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	cursorKey := []byte(settings.cursor.secret)
+	if len(cursorKey) == 0 {
+		cursorKey = make([]byte, 32)
+		_, err := rand.Read(cursorKey)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		logger.Info("no cursor secret configured, cursors will not survive a restart")
+	}
+	data.SetCursorKey(cursorKey)
+
+	store, err := storage.NewLocal(settings.storage.dir)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	db, err := openDB(settings)
 	if err != nil {
 		logger.Error(err.Error())
@@ -88,19 +154,55 @@ func main() {
 	defer db.Close()
 	logger.Info("database connection pool established")
 
+	screener := contentfilter.AllowAll
+	var blocklist *contentfilter.Blocklist
+	if settings.blocklist.path != "" {
+		blocklist, err = contentfilter.LoadBlocklist(settings.blocklist.path)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		screener = blocklist
+		logger.Info("blocklist loaded", "rules", blocklist.Len())
+	}
+
+	bookCache := cache.New[int64, *data.Book](settings.cache.size, settings.cache.ttl)
+	permissionCache := cache.New[int64, data.Permissions](settings.cache.size, settings.cache.ttl)
+
+	expvar.NewString("version").Set(appVersion)
+	expvar.Publish("cache", expvar.Func(func() any {
+		return map[string]cache.Stats{
+			"books":       bookCache.Stats(),
+			"permissions": permissionCache.Stats(),
+		}
+	}))
+
 	appInstance := &applicationDependencies{
 		config:           settings,
 		logger:           logger,
-		bookModel:        data.BookModel{DB: db},
+		bookModel:        data.CachedBookModel{BookModel: data.BookModel{DB: db}, Cache: bookCache},
+		authorModel:      data.AuthorModel{DB: db},
+		workModel:        data.WorkModel{DB: db},
+		seriesModel:      data.SeriesModel{DB: db},
+		trashModel:       data.TrashModel{DB: db},
 		readingListModel: data.ReadingListModel{DB: db},
 		reviewModel:      data.ReviewModel{DB: db},
+		commentModel:     data.CommentModel{DB: db},
+		moderationModel:  data.ModerationModel{DB: db},
 		userModel:        data.UserModel{DB: db},
 		mailer: mailer.New(settings.smtp.host, settings.smtp.port,
 			settings.smtp.username, settings.smtp.password, settings.smtp.sender),
 		tokenModel:      data.TokenModel{DB: db},
-		permissionModel: data.PermissionModel{DB: db},
+		permissionModel: data.CachedPermissionModel{PermissionModel: data.PermissionModel{DB: db}, Cache: permissionCache},
+		store:           store,
+		screener:        screener,
+		shutdown:        make(chan struct{}),
 	}
 
+	appInstance.startPurger()
+	appInstance.startBlocklistWatcher(blocklist)
+	appInstance.renderStaleReviews()
+
 	err = appInstance.serve()
 	if err != nil {
 		logger.Error(err.Error())
@@ -6,6 +6,7 @@ import (
 	//"log"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -177,10 +178,11 @@ func (a *applicationDependencies) enableCORS (next http.Handler) http.Handler {
 			for i:= range a.config.cors.trustedOrigins {
 				if origin == a.config.cors.trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Expose-Headers", "ETag")
 					// check if it is a Preflight CORS request
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-		 				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		 				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match")
 						w.WriteHeader(http.StatusOK)
              		 	return
           			}
@@ -193,4 +195,25 @@ func (a *applicationDependencies) enableCORS (next http.Handler) http.Handler {
 		 next.ServeHTTP(w, r)
 	 })
  }
- 
\ No newline at end of file
+ 
+// aliasRoutes serves each of the given /v1 paths, and anything below it,
+// from the same path under /api. httprouter does not allow a static segment
+// such as /v1/books/import next to the /v1/books/:id wildcard, so those
+// routes are registered under /api/v1 and reached from /v1 through here.
+func (a *applicationDependencies) aliasRoutes(next http.Handler, paths ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range paths {
+			if r.URL.Path == path || strings.HasPrefix(r.URL.Path, path+"/") {
+				aliased := new(http.Request)
+				*aliased = *r
+				aliased.URL = new(url.URL)
+				*aliased.URL = *r.URL
+				aliased.URL.Path = "/api" + r.URL.Path
+				aliased.URL.RawPath = ""
+				r = aliased
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tchenbz/test3AWT/internal/data"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+func (a *applicationDependencies) reportReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	report := &data.Report{
+		ReviewID: reviewID,
+		UserID:   a.contextGetUser(r).ID,
+		Reason:   input.Reason,
+		Details:  input.Details,
+	}
+
+	v := validator.New()
+	data.ValidateReport(v, report)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.moderationModel.Report(report)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrOwnReview):
+			a.ownReviewResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"report": report}
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	query := r.URL.Query()
+	input.Status = a.getSingleQueryParameter(query, "status", "")
+	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
+	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 20, v)
+	input.Filters.Sort = "-open_reports"
+	input.Filters.SortSafeList = []string{"-open_reports"}
+
+	v.Check(input.Status == "" || validator.PermittedValue(input.Status, data.ModerationStatuses...), "status", "must be visible, pending, held, hidden or removed")
+	data.ValidateFilters(v, input.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	items, metadata, err := a.moderationModel.GetQueue(input.Status, input.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"queue":    items,
+		"metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayModerationReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := a.moderationModel.GetReview(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	reports, err := a.moderationModel.GetReports(review.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	actions, err := a.moderationModel.GetActions(review.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"review":  review,
+		"reports": reports,
+		"actions": actions,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// moderateReviewHandler hides, restores or removes a review. Every action
+// needs a note explaining it, which is kept in the review's history.
+func (a *applicationDependencies) moderateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	action := httprouter.ParamsFromContext(r.Context()).ByName("action")
+	if !validator.PermittedValue(action, data.ModerationActions...) {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Note string `json:"note"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateModerationNote(v, input.Note)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	moderator := a.contextGetUser(r)
+	record, err := a.moderationModel.Moderate(reviewID, moderator.ID, action, input.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	record.Moderator = &moderator.Username
+
+	review, err := a.moderationModel.GetReview(reviewID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	a.bookModel.Invalidate(review.BookID)
+
+	data := envelope{
+		"review": review,
+		"action": record,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
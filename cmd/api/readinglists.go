@@ -31,6 +31,14 @@ func (a *applicationDependencies) createReadingListHandler(w http.ResponseWriter
 		Status:      input.Status,
 	}
 
+	v := validator.New()
+	data.ValidateReadingList(v, list)
+	a.screenReadingList(v, list)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = a.readingListModel.Insert(list)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
@@ -73,7 +81,7 @@ func (a *applicationDependencies) displayReadingListHandler(w http.ResponseWrite
 	}
 
 	data := envelope{"reading_list": list}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, http.StatusOK, data, versionHeaders(list.Version))
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -105,6 +113,11 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 		return
 	}
 
+	if !ifMatch(r, etag(list.Version)) {
+		a.preconditionFailedResponse(w, r)
+		return
+	}
+
 	var input struct {
 		Name        *string `json:"name"`
 		Description *string `json:"description"`
@@ -127,6 +140,14 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 		list.Status = *input.Status
 	}
 
+	v := validator.New()
+	data.ValidateReadingList(v, list)
+	a.screenReadingList(v, list)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = a.readingListModel.Update(list)
 	if err != nil {
 		switch {
@@ -139,7 +160,7 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 	}
 
 	data := envelope{"reading_list": list}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, http.StatusOK, data, versionHeaders(list.Version))
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -170,11 +191,18 @@ func (a *applicationDependencies) deleteReadingListHandler(w http.ResponseWriter
 		return
 	}
 
-	err = a.readingListModel.Delete(id)
+	if !ifMatch(r, etag(list.Version)) {
+		a.preconditionFailedResponse(w, r)
+		return
+	}
+
+	err = a.readingListModel.Delete(list.ID, list.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
 		default:
 			a.serverErrorResponse(w, r, err)
 		}
@@ -225,7 +253,12 @@ func (a *applicationDependencies) addBookToReadingListHandler(w http.ResponseWri
 
 	err = a.readingListModel.AddBook(listID, input.BookID)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateWork):
+			a.failedValidationResponse(w, r, map[string]string{"book_id": "another edition of this book is already on the list"})
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -294,6 +327,8 @@ func (a *applicationDependencies) listReadingListsHandler(w http.ResponseWriter,
 	input.Name = a.getSingleQueryParameter(query, "name", "")
 	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
 	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
+	input.Filters.Keyset = query.Has("cursor")
+	input.Filters.Cursor = query.Get("cursor")
 	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
 	input.Filters.SortSafeList = []string{"id", "name", "-id", "-name"}
 
@@ -18,8 +18,9 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
     }
 
     var input struct {
-        Content string `json:"content"`
-        Rating  int    `json:"rating"`
+        Content          string `json:"content"`
+        Rating           int    `json:"rating"`
+        ContainsSpoilers bool   `json:"contains_spoilers"`
     }
 
     err = a.readJSON(w, r, &input)
@@ -29,25 +30,77 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
     }
 
     review := &data.Review{
-        BookID:  bookID,
-        Author:  user.Username,
-        Content: input.Content,
-        Rating:  input.Rating,
+        BookID:           bookID,
+        UserID:           user.ID,
+        Author:           user.Username,
+        Content:          input.Content,
+        Rating:           input.Rating,
+        ContainsSpoilers: input.ContainsSpoilers,
     }
 
-    err = a.reviewModel.Insert(review)
+    v := validator.New()
+    data.ValidateReview(v, review)
+    a.screenReview(v, review)
+    if !v.IsEmpty() {
+        a.failedValidationResponse(w, r, v.Errors)
+        return
+    }
+
+    // A user has one review per book, so posting again replaces it.
+    created, err := a.reviewModel.Upsert(review)
     if err != nil {
-        a.serverErrorResponse(w, r, err)
+        switch {
+        case errors.Is(err, data.ErrReviewRemoved):
+            a.reviewRemovedResponse(w, r)
+        default:
+            a.serverErrorResponse(w, r, err)
+        }
         return
     }
+    a.bookModel.Invalidate(review.BookID)
+
+    status := http.StatusOK
+    if created {
+        status = http.StatusCreated
+    }
 
     data := envelope{"review": review}
-    err = a.writeJSON(w, http.StatusCreated, data, nil)
+    err = a.writeJSON(w, status, data, modifiedHeaders(review.Version, review.UpdatedAt))
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
 }
 
+func (a *applicationDependencies) displayReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := a.reviewModel.Get(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.canSeeReview(r, review) {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	data := envelope{"review": review}
+	err = a.writeCacheableJSON(w, r, data, modifiedHeaders(review.Version, review.UpdatedAt))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
 func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
     user := a.contextGetUser(r) 
 
@@ -68,15 +121,20 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
         return
     }
 
-    if review.Author != user.Username {
+    if review.UserID != user.ID {
         a.notPermittedResponse(w, r)
         return
     }
 
+    if !ifMatch(r, etagAt(review.Version, review.UpdatedAt)) {
+        a.preconditionFailedResponse(w, r)
+        return
+    }
+
     var input struct {
-        Content      *string `json:"content"`
-        Rating       *int    `json:"rating"`
-        HelpfulCount *int    `json:"helpful_count"`
+        Content          *string `json:"content"`
+        Rating           *int    `json:"rating"`
+        ContainsSpoilers *bool   `json:"contains_spoilers"`
     }
 
     err = a.readJSON(w, r, &input)
@@ -91,8 +149,16 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
     if input.Rating != nil {
         review.Rating = *input.Rating
     }
-    if input.HelpfulCount != nil {
-        review.HelpfulCount = *input.HelpfulCount
+    if input.ContainsSpoilers != nil {
+        review.ContainsSpoilers = *input.ContainsSpoilers
+    }
+
+    v := validator.New()
+    data.ValidateReview(v, review)
+    a.screenReview(v, review)
+    if !v.IsEmpty() {
+        a.failedValidationResponse(w, r, v.Errors)
+        return
     }
 
     err = a.reviewModel.Update(review)
@@ -105,9 +171,10 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
         }
         return
     }
+    a.bookModel.Invalidate(review.BookID)
 
     data := envelope{"review": review}
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.writeJSON(w, http.StatusOK, data, modifiedHeaders(review.Version, review.UpdatedAt))
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
@@ -133,21 +200,29 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
         return
     }
 
-    if review.Author != user.Username {
+    if review.UserID != user.ID {
         a.notPermittedResponse(w, r)
         return
     }
 
-    err = a.reviewModel.Delete(reviewID)
+    if !ifMatch(r, etagAt(review.Version, review.UpdatedAt)) {
+        a.preconditionFailedResponse(w, r)
+        return
+    }
+
+    err = a.reviewModel.Delete(reviewID, review.Version)
     if err != nil {
         switch {
         case errors.Is(err, data.ErrRecordNotFound):
             a.notFoundResponse(w, r)
+        case errors.Is(err, data.ErrEditConflict):
+            a.editConflictResponse(w, r)
         default:
             a.serverErrorResponse(w, r, err)
         }
         return
     }
+    a.bookModel.Invalidate(review.BookID)
 
     data := envelope{"message": "review successfully deleted"}
     err = a.writeJSON(w, http.StatusOK, data, nil)
@@ -164,9 +239,10 @@ func (a *applicationDependencies) listBookReviewsHandler(w http.ResponseWriter,
 	}
 
 	var input struct {
-		Content string
-		Author  string
-		Rating  int
+		Content  string
+		Author   string
+		Rating   int
+		Spoilers string
 		data.Filters
 	}
 
@@ -174,12 +250,16 @@ func (a *applicationDependencies) listBookReviewsHandler(w http.ResponseWriter,
 	input.Content = a.getSingleQueryParameter(query, "content", "")
 	input.Author = a.getSingleQueryParameter(query, "author", "")
 	input.Rating = a.getSingleIntegerParameter(query, "rating", 0, validator.New())
+	input.Spoilers = a.getSingleQueryParameter(query, "spoilers", a.spoilerPreference(r))
 	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
 	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
+	input.Filters.Keyset = query.Has("cursor")
+	input.Filters.Cursor = query.Get("cursor")
 	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
 	input.Filters.SortSafeList = []string{"id", "rating", "helpful_count", "-id", "-rating", "-helpful_count"}
 
 	v := validator.New()
+	v.Check(validator.PermittedValue(input.Spoilers, data.SpoilerSettings...), "spoilers", "must be hide or show")
 	data.ValidateFilters(v, input.Filters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
@@ -192,12 +272,135 @@ func (a *applicationDependencies) listBookReviewsHandler(w http.ResponseWriter,
 		return
 	}
 
+	if input.Spoilers == data.SpoilersHide {
+		a.redactSpoilers(r, reviews)
+	}
+
 	data := envelope{
 		"reviews":  reviews,
 		"metadata": metadata,
 	}
+	err = a.writeCacheableJSON(w, r, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// canSeeReview reports whether the current user may see a review. Reviews a
+// moderator has hidden or the content filter has held are only shown to
+// their author.
+func (a *applicationDependencies) canSeeReview(r *http.Request, review *data.Review) bool {
+	return review.Visible() || review.UserID == a.contextGetUser(r).ID
+}
+
+// listReviewRevisionsHandler shows the earlier versions of a review. Only the
+// review's author and moderators may see them.
+func (a *applicationDependencies) listReviewRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := a.moderationModel.GetReview(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	permissions, err := a.permissionModel.GetAllForUser(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !permissions.Include("reviews:moderate") {
+		if review.ModerationStatus == data.ModerationRemoved {
+			a.notFoundResponse(w, r)
+			return
+		}
+		if review.UserID != user.ID {
+			a.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	revisions, err := a.reviewModel.GetRevisions(review.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"review_id":      review.ID,
+		"version":        review.Version,
+		"edited_at":      review.EditedAt,
+		"revision_count": review.RevisionCount,
+		"revisions":      revisions,
+	}
 	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
+
+// spoilerPreference returns the current user's choice of whether review
+// listings hide spoilers. Anonymous users see them, as clients did before
+// spoilers could be marked.
+func (a *applicationDependencies) spoilerPreference(r *http.Request) string {
+	spoilers := a.contextGetUser(r).Preferences.Spoilers
+	if spoilers == "" {
+		return data.SpoilersShow
+	}
+	return spoilers
+}
+
+// redactSpoilers hides the spoilers in reviews, except in the current user's
+// own reviews.
+func (a *applicationDependencies) redactSpoilers(r *http.Request, reviews []*data.Review) {
+	user := a.contextGetUser(r)
+	for _, review := range reviews {
+		if review.UserID != user.ID {
+			review.RedactSpoilers()
+		}
+	}
+}
+
+// renderStaleReviews renders, in the background, the Markdown of reviews
+// stored before the current renderer, a batch at a time. It stops between
+// batches if the server shuts down; the rest are rendered on the next start.
+func (a *applicationDependencies) renderStaleReviews() {
+	a.background(func() {
+		total := 0
+		defer func() {
+			if total > 0 {
+				a.logger.Info("rendered reviews", "rows", total)
+			}
+		}()
+
+		for {
+			select {
+			case <-a.shutdown:
+				return
+			default:
+			}
+
+			rendered, err := a.reviewModel.RenderStale(100)
+			if err != nil {
+				a.logger.Error("failed to render reviews", "error", err)
+				return
+			}
+			if rendered == 0 {
+				return
+			}
+			total += rendered
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/tchenbz/test3AWT/internal/data"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+func (a *applicationDependencies) voteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Value int `json:"value"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateVote(v, input.Value)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	helpfulCount, err := a.reviewModel.Vote(reviewID, a.contextGetUser(r).ID, input.Value)
+	if err != nil {
+		a.voteErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"review_id":     reviewID,
+		"helpful_count": helpfulCount,
+		"vote":          input.Value,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) unvoteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	helpfulCount, err := a.reviewModel.Unvote(reviewID, a.contextGetUser(r).ID)
+	if err != nil {
+		a.voteErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"review_id":     reviewID,
+		"helpful_count": helpfulCount,
+		"vote":          nil,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) voteErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		a.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrOwnReview):
+		a.ownReviewResponse(w, r)
+	default:
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"net/http"
 	"github.com/julienschmidt/httprouter"
 )
@@ -10,14 +11,51 @@ func (a *applicationDependencies) routes() http.Handler {
 	router.NotFound = http.HandlerFunc(a.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(a.methodNotAllowedResponse)
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", a.healthCheckHandler)
+	router.HandlerFunc(http.MethodGet, "/debug/vars", a.requirePermission("metrics:read", expvar.Handler().ServeHTTP))
 
 	// Book routes
 	router.HandlerFunc(http.MethodGet, "/api/v1/books/search", a.searchBooksHandler)
+	router.HandlerFunc(http.MethodGet, "/api/v1/books/isbn/:isbn", a.requirePermission("comments:read", a.displayBookByISBNHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/books/export", a.requirePermission("comments:read", a.exportBooksHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/books/import", a.requirePermission("comments:write", a.importBooksHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/books", a.requirePermission("comments:write", a.createBookHandler))	
 	router.HandlerFunc(http.MethodGet, "/v1/books/:id", a.requirePermission("comments:read",a.displayBookHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/books/:id", a.requirePermission("comments:write", a.updateBookHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/books/:id", a.requirePermission("comments:write", a.deleteBookHandler))
     router.HandlerFunc(http.MethodGet, "/v1/books", a.requirePermission("comments:read", a.listBooksHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/books/:id/cover", a.requirePermission("comments:write", a.uploadBookCoverHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/cover/:size", a.displayBookCoverHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/history", a.requirePermission("comments:read", a.bookHistoryHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/revert", a.requirePermission("comments:write", a.revertBookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/next", a.requirePermission("comments:read", a.nextInSeriesHandler))
+
+	// Series routes
+	router.HandlerFunc(http.MethodPost, "/v1/series", a.requirePermission("comments:write", a.createSeriesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/series", a.requirePermission("comments:read", a.listSeriesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/series/:id", a.requirePermission("comments:read", a.displaySeriesHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/series/:id", a.requirePermission("comments:write", a.updateSeriesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/series/:id", a.requirePermission("comments:write", a.deleteSeriesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/series/:id/books", a.requirePermission("comments:write", a.addBookToSeriesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/series/:id/books/:book_id", a.requirePermission("comments:write", a.removeBookFromSeriesHandler))
+
+	// Author routes
+	router.HandlerFunc(http.MethodPost, "/v1/authors", a.requirePermission("comments:write", a.createAuthorHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/authors", a.requirePermission("comments:read", a.listAuthorsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/authors/:id", a.requirePermission("comments:read", a.displayAuthorHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/authors/:id", a.requirePermission("comments:write", a.updateAuthorHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/authors/:id", a.requirePermission("comments:write", a.deleteAuthorHandler))
+
+	// Work routes
+	router.HandlerFunc(http.MethodPost, "/v1/works", a.requirePermission("comments:write", a.createWorkHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/works", a.requirePermission("comments:read", a.listWorksHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/works/:id", a.requirePermission("comments:read", a.displayWorkHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/works/:id", a.requirePermission("comments:write", a.updateWorkHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/works/:id", a.requirePermission("comments:write", a.deleteWorkHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/works/:id/editions", a.requirePermission("comments:read", a.listWorkEditionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/works/:id/editions", a.requirePermission("comments:write", a.attachWorkEditionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/works/:id/editions/:book_id", a.requirePermission("comments:write", a.detachWorkEditionHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/works/:id/preferred-edition", a.requirePermission("comments:write", a.setPreferredEditionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/works/:id/reviews", a.requirePermission("reviews:read", a.listWorkReviewsHandler))
 
 	// Reading List routes
 	router.HandlerFunc(http.MethodPost, "/v1/lists", a.requirePermission("readinglists:write", a.createReadingListHandler))
@@ -31,8 +69,28 @@ func (a *applicationDependencies) routes() http.Handler {
 	// Review routes
 	router.HandlerFunc(http.MethodPost, "/v1/books/:id/reviews", a.requirePermission("reviews:write", a.createReviewHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/books/:id/reviews", a.requirePermission("reviews:read", a.listBookReviewsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reviews/:id", a.requirePermission("reviews:read", a.displayReviewHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/reviews/:id", a.requirePermission("reviews:write", a.updateReviewHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/reviews/:id", a.requirePermission("reviews:write", a.deleteReviewHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/reviews/:id/helpful", a.requirePermission("reviews:write", a.voteReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/reviews/:id/helpful", a.requirePermission("reviews:write", a.unvoteReviewHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/reviews/:id/reports", a.requirePermission("reviews:read", a.reportReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reviews/:id/revisions", a.requirePermission("reviews:read", a.listReviewRevisionsHandler))
+
+	// Moderation routes
+	router.HandlerFunc(http.MethodGet, "/v1/moderation/reviews", a.requirePermission("reviews:moderate", a.listModerationQueueHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/moderation/reviews/:id", a.requirePermission("reviews:moderate", a.displayModerationReviewHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/moderation/reviews/:id/:action", a.requirePermission("reviews:moderate", a.moderateReviewHandler))
+
+	// Comment routes
+	router.HandlerFunc(http.MethodPost, "/v1/reviews/:id/comments", a.requirePermission("comments:write", a.createCommentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reviews/:id/comments", a.requirePermission("comments:read", a.listCommentsHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/reviews/:id/comments/:comment_id", a.requirePermission("comments:write", a.updateCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/reviews/:id/comments/:comment_id", a.requirePermission("comments:write", a.deleteCommentHandler))
+
+	// Trash routes
+	router.HandlerFunc(http.MethodGet, "/v1/trash", a.requirePermission("trash:manage", a.listTrashHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/trash/:type/:id/restore", a.requirePermission("trash:manage", a.restoreTrashHandler))
 
 	// User routes
 	router.HandlerFunc(http.MethodPost, "/v1/users", a.registerUserHandler)
@@ -44,8 +102,12 @@ func (a *applicationDependencies) routes() http.Handler {
 	
 	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/password-reset", (a.createPasswordResetTokenHandler))
 	router.HandlerFunc(http.MethodPut, "/v1/users/password", a.resetPasswordHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/users/preferences", a.requireActivatedUser(a.updatePreferencesHandler))
+
 
+	// Book routes that cannot share the /v1/books/:id tree
+	aliased := a.aliasRoutes(router, "/v1/books/import", "/v1/books/export", "/v1/books/isbn")
 
 	// Return router with panic recovery and rate limiting
-	return a.recoverPanic(a.enableCORS(a.rateLimit(a.authenticate(router))))
+	return a.recoverPanic(a.enableCORS(a.rateLimit(a.authenticate(aliased))))
 }
@@ -34,6 +34,7 @@ func (a *applicationDependencies)serve() error {
 			shutdownError <- err
 		 }
 		  a.logger.Info("completing background tasks", "address", apiServer.Addr)
+		  close(a.shutdown)
 		  a.wg.Wait()
 		 shutdownError <- nil  	   
 		}()
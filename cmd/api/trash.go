@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tchenbz/test3AWT/internal/data"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+func (a *applicationDependencies) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Type string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	query := r.URL.Query()
+	input.Type = a.getSingleQueryParameter(query, "type", "")
+	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
+	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 20, v)
+	input.Filters.Sort = "-deleted_at"
+	input.Filters.SortSafeList = []string{"-deleted_at"}
+
+	v.Check(input.Type == "" || validator.PermittedValue(input.Type, data.TrashTypes...), "type", "must be books, reviews or reading_lists")
+	data.ValidateFilters(v, input.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	items, metadata, err := a.trashModel.GetAll(input.Type, input.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"trash":    items,
+		"metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) restoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	kind := httprouter.ParamsFromContext(r.Context()).ByName("type")
+	if !validator.PermittedValue(kind, data.TrashTypes...) {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.trashModel.Restore(kind, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateISBN):
+			a.failedValidationResponse(w, r, map[string]string{"isbn": "another book with this ISBN already exists"})
+		case errors.Is(err, data.ErrDuplicateReview):
+			a.failedValidationResponse(w, r, map[string]string{"review": "the reviewer has since written another review of this book"})
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if kind == data.TrashReviews {
+		a.bookModel.InvalidateAll()
+	}
+
+	data := envelope{"message": fmt.Sprintf("%s item %d restored", kind, id)}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// startPurger permanently deletes trashed items and review revisions once
+// they are older than their configured retention, checking once an hour. A
+// retention of zero keeps them forever.
+func (a *applicationDependencies) startPurger() {
+	if a.config.trash.retention <= 0 && a.config.revisions.retention <= 0 {
+		return
+	}
+
+	a.runPeriodically(time.Hour, func() {
+		if a.config.trash.retention > 0 {
+			purged, err := a.trashModel.Purge(a.config.trash.retention)
+			if err != nil {
+				a.logger.Error("failed to purge trash", "error", err)
+			} else if purged > 0 {
+				a.logger.Info("purged trash", "rows", purged)
+			}
+		}
+
+		if a.config.revisions.retention > 0 {
+			pruned, err := a.reviewModel.PruneRevisions(a.config.revisions.retention)
+			if err != nil {
+				a.logger.Error("failed to prune review revisions", "error", err)
+			} else if pruned > 0 {
+				a.logger.Info("pruned review revisions", "rows", pruned)
+			}
+		}
+	})
+}
@@ -185,6 +185,8 @@ func (a *applicationDependencies) getUserReadingListsHandler(w http.ResponseWrit
 	input.Name = a.getSingleQueryParameter(query, "name", "")
 	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
 	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
+	input.Filters.Keyset = query.Has("cursor")
+	input.Filters.Cursor = query.Get("cursor")
 	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
 	input.Filters.SortSafeList = []string{"id", "name", "-id", "-name"}
 
@@ -219,9 +221,10 @@ func (a *applicationDependencies) getUserReviewsHandler(w http.ResponseWriter, r
 	}
 
 	var input struct {
-		Content string
-		Author  string
-		Rating  int
+		Content  string
+		Author   string
+		Rating   int
+		Spoilers string
 		data.Filters
 	}
 
@@ -229,12 +232,16 @@ func (a *applicationDependencies) getUserReviewsHandler(w http.ResponseWriter, r
 	input.Content = a.getSingleQueryParameter(query, "content", "")
 	input.Author = a.getSingleQueryParameter(query, "author", "")
 	input.Rating = a.getSingleIntegerParameter(query, "rating", 0, validator.New())
+	input.Spoilers = a.getSingleQueryParameter(query, "spoilers", a.spoilerPreference(r))
 	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
 	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
+	input.Filters.Keyset = query.Has("cursor")
+	input.Filters.Cursor = query.Get("cursor")
 	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
 	input.Filters.SortSafeList = []string{"id", "rating", "helpful_count", "-id", "-rating", "-helpful_count"}
 
 	v := validator.New()
+	v.Check(validator.PermittedValue(input.Spoilers, data.SpoilerSettings...), "spoilers", "must be hide or show")
 	data.ValidateFilters(v, input.Filters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
@@ -247,6 +254,10 @@ func (a *applicationDependencies) getUserReviewsHandler(w http.ResponseWriter, r
 		return
 	}
 
+	if input.Spoilers == data.SpoilersHide {
+		a.redactSpoilers(r, reviews)
+	}
+
 	data := envelope{
 		"reviews":  reviews,
 		"metadata": metadata,
@@ -256,3 +267,46 @@ func (a *applicationDependencies) getUserReviewsHandler(w http.ResponseWriter, r
 		a.serverErrorResponse(w, r, err)
 	}
 }
+
+func (a *applicationDependencies) updatePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	var input struct {
+		Spoilers *string `json:"spoilers"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	prefs := user.Preferences
+	if input.Spoilers != nil {
+		prefs.Spoilers = *input.Spoilers
+	}
+
+	v := validator.New()
+	data.ValidatePreferences(v, prefs)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.userModel.UpdatePreferences(user.ID, prefs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"preferences": prefs}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
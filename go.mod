@@ -5,6 +5,7 @@ go 1.23.2
 require (
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/lib/pq v1.10.9
+	golang.org/x/image v0.25.0
 	golang.org/x/time v0.8.0
 )
 
@@ -0,0 +1,154 @@
+// Package cache provides a bounded, in-process cache with least recently
+// used eviction and a time to live on every entry.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts how a cache has been used since it was created.
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+	Capacity  int    `json:"capacity"`
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// Cache holds at most capacity entries, each for at most ttl. It is safe for
+// concurrent use. A cache with a capacity or ttl of zero stores nothing.
+type Cache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[K]*list.Element
+	order    *list.List
+	stamp    uint64
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+func New[K comparable, V any](capacity int, ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the value stored for key, if it has not expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+
+	e := element.Value.(*entry[K, V])
+	if time.Now().After(e.expires) {
+		c.remove(element)
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits.Add(1)
+	return e.value, true
+}
+
+// Stamp returns a token to pass to Fill. Take it before loading the value
+// from the source of truth.
+func (c *Cache[K, V]) Stamp() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stamp
+}
+
+// Fill stores value for key unless the cache has been invalidated since stamp
+// was taken, so a slow load cannot put back data that a concurrent write has
+// just invalidated.
+func (c *Cache[K, V]) Fill(stamp uint64, key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stamp != c.stamp || c.capacity <= 0 || c.ttl <= 0 {
+		return
+	}
+
+	expires := time.Now().Add(c.ttl)
+
+	if element, ok := c.items[key]; ok {
+		e := element.Value.(*entry[K, V])
+		e.value = value
+		e.expires = expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// Delete invalidates the entries for keys.
+func (c *Cache[K, V]) Delete(keys ...K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stamp++
+	for _, key := range keys {
+		if element, ok := c.items[key]; ok {
+			c.remove(element)
+		}
+	}
+}
+
+// Purge invalidates every entry.
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stamp++
+	c.items = make(map[K]*list.Element)
+	c.order.Init()
+}
+
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Size:      size,
+		Capacity:  c.capacity,
+	}
+}
+
+func (c *Cache[K, V]) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*entry[K, V]).key)
+}
@@ -0,0 +1,164 @@
+package contentfilter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Blocklist is a Screener backed by a file of rules, one per line:
+//
+//	# comments and blank lines are ignored
+//	reject   someword
+//	mask     another word
+//	moderate re:(?i)buy\s+followers
+//
+// Each rule names an action and a pattern. Plain patterns match words and
+// phrases case-insensitively, and only as whole words at an end that is a
+// letter, digit or underscore, so "ass" does not match "class" but "$$$"
+// still matches. Patterns prefixed with "re:" are Go regular expressions
+// matched as written. Reload rereads the file when it changes.
+type Blocklist struct {
+	path string
+
+	mu      sync.RWMutex
+	rules   []rule
+	modTime time.Time
+}
+
+type rule struct {
+	action  Action
+	pattern *regexp.Regexp
+}
+
+// LoadBlocklist reads the rules in the file at path.
+func LoadBlocklist(path string) (*Blocklist, error) {
+	b := &Blocklist{path: path}
+	_, err := b.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload rereads the file if its modification time has changed since it was
+// last read, and reports whether it did. If the file cannot be read or has a
+// bad rule, the rules already loaded stay in force.
+func (b *Blocklist) Reload() (bool, error) {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.RLock()
+	unchanged := info.ModTime().Equal(b.modTime)
+	b.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	rules, err := parseRules(b.path)
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.Lock()
+	b.rules = rules
+	b.modTime = info.ModTime()
+	b.mu.Unlock()
+
+	return true, nil
+}
+
+// Len returns the number of rules loaded.
+func (b *Blocklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.rules)
+}
+
+func (b *Blocklist) Screen(text string) Result {
+	b.mu.RLock()
+	rules := b.rules
+	b.mu.RUnlock()
+
+	result := Result{Action: Allow, Text: text}
+	for _, r := range rules {
+		if !r.pattern.MatchString(text) {
+			continue
+		}
+		if r.action == Mask {
+			result.Text = r.pattern.ReplaceAllStringFunc(result.Text, func(match string) string {
+				return strings.Repeat("*", utf8.RuneCountInString(match))
+			})
+		}
+		result.Action = max(result.Action, r.action)
+	}
+
+	return result
+}
+
+func parseRules(path string) ([]rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []rule
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name := strings.Fields(line)[0]
+		pattern := strings.TrimSpace(line[len(name):])
+		if pattern == "" {
+			return nil, fmt.Errorf("%s:%d: rule must be an action followed by a pattern", path, n)
+		}
+
+		action, err := ParseAction(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+
+		expr, isRegexp := strings.CutPrefix(pattern, "re:")
+		if !isRegexp {
+			words := strings.Fields(pattern)
+			for i, word := range words {
+				words[i] = regexp.QuoteMeta(word)
+			}
+			expr = `(?i)` + wordBoundary(pattern[0]) + strings.Join(words, `\s+`) + wordBoundary(pattern[len(pattern)-1])
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+
+		rules = append(rules, rule{action: action, pattern: re})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// wordBoundary returns a \b assertion if c, the end of a plain pattern, is a
+// word character. Next to any other character \b would require a word
+// character on the far side, so those ends are left unanchored.
+func wordBoundary(c byte) string {
+	if c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+		return `\b`
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package contentfilter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRules(t *testing.T, rules string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	err := os.WriteFile(path, []byte(rules), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		want    []Action
+		wantErr string
+	}{
+		{
+			name:  "comments and blank lines",
+			rules: "# a comment\n\n   \nreject spam\n",
+			want:  []Action{Reject},
+		},
+		{
+			name:  "every action",
+			rules: "reject one\nMASK two words\nmoderate re:(?i)three\n",
+			want:  []Action{Reject, Mask, Moderate},
+		},
+		{
+			name:    "unknown action",
+			rules:   "reject one\nban two\n",
+			wantErr: `:2: unknown action "ban"`,
+		},
+		{
+			name:    "missing pattern",
+			rules:   "mask\n",
+			wantErr: ":1: rule must be an action followed by a pattern",
+		},
+		{
+			name:    "bad regular expression",
+			rules:   "reject re:(unclosed\n",
+			wantErr: ":1: error parsing regexp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseRules(writeRules(t, tt.rules))
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(rules) != len(tt.want) {
+				t.Fatalf("got %d rules, want %d", len(rules), len(tt.want))
+			}
+			for i, r := range rules {
+				if r.action != tt.want[i] {
+					t.Errorf("rule %d: got action %s, want %s", i, r.action, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScreen(t *testing.T) {
+	path := writeRules(t, `
+reject   spam
+mask     darn
+mask     f*ck
+mask     $$$
+mask     ass
+moderate buy followers
+moderate re:\d{3}-\d{4}
+`)
+
+	blocklist, err := LoadBlocklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		text       string
+		wantAction Action
+		wantText   string
+	}{
+		{"clean", "A lovely book.", Allow, "A lovely book."},
+		{"reject", "Buy SPAM now", Reject, ""},
+		{"mask", "Darn it, darn it all", Mask, "**** it, **** it all"},
+		{"mask inside word is left", "darnation and class", Allow, "darnation and class"},
+		{"mask punctuation in word", "what the f*ck", Mask, "what the ****"},
+		{"mask punctuation only", "cost $$$ to print", Mask, "cost *** to print"},
+		{"moderate phrase", "you can buy\n followers here", Moderate, "you can buy\n followers here"},
+		{"moderate regexp", "call 555-1234", Moderate, "call 555-1234"},
+		{"most severe wins", "darn, buy followers", Moderate, "****, buy followers"},
+		{"reject beats all", "darn spam, buy followers", Reject, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := blocklist.Screen(tt.text)
+			if got.Action != tt.wantAction {
+				t.Errorf("got action %s, want %s", got.Action, tt.wantAction)
+			}
+			if tt.wantAction != Reject && got.Text != tt.wantText {
+				t.Errorf("got text %q, want %q", got.Text, tt.wantText)
+			}
+		})
+	}
+}
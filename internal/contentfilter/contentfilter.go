@@ -0,0 +1,71 @@
+// Package contentfilter screens user-written text such as reviews and
+// reading list names before it is saved. A Screener decides whether text is
+// accepted as is, has words masked, is held for a moderator, or is rejected.
+package contentfilter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action is the outcome of screening a piece of text. Actions are ordered by
+// severity, so when several rules match the most severe one wins.
+type Action int
+
+const (
+	Allow Action = iota
+	Mask
+	Moderate
+	Reject
+)
+
+func (a Action) String() string {
+	switch a {
+	case Allow:
+		return "allow"
+	case Mask:
+		return "mask"
+	case Moderate:
+		return "moderate"
+	case Reject:
+		return "reject"
+	default:
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+}
+
+// ParseAction returns the action with the given name.
+func ParseAction(name string) (Action, error) {
+	switch strings.ToLower(name) {
+	case "mask":
+		return Mask, nil
+	case "moderate":
+		return Moderate, nil
+	case "reject":
+		return Reject, nil
+	default:
+		return Allow, fmt.Errorf("unknown action %q", name)
+	}
+}
+
+// Result is the outcome of screening text. Text is the input with every
+// match of a mask rule replaced by asterisks; it is only meaningful when the
+// action is Mask or Moderate.
+type Result struct {
+	Action Action
+	Text   string
+}
+
+type Screener interface {
+	Screen(text string) Result
+}
+
+// AllowAll is a Screener that accepts all text unchanged. It is used when no
+// blocklist is configured.
+var AllowAll Screener = allowAll{}
+
+type allowAll struct{}
+
+func (allowAll) Screen(text string) Result {
+	return Result{Action: Allow, Text: text}
+}
@@ -0,0 +1,134 @@
+// Package cover validates uploaded book cover images and renders the sizes
+// the API serves. Every size is re-encoded from decoded pixels, so EXIF, XMP
+// and other metadata in the upload never reach storage.
+package cover
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrTooLarge        = errors.New("image dimensions are too large")
+	ErrInvalidImage    = errors.New("image could not be decoded")
+)
+
+// MaxPixels bounds width*height before an upload is decoded, so a small file
+// cannot expand into gigabytes of pixels.
+const MaxPixels = 40_000_000
+
+// ContentTypes are the upload formats that are accepted.
+var ContentTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+type Size struct {
+	Name     string
+	MaxWidth int
+}
+
+// Sizes are rendered for every upload. Images are only ever scaled down.
+var Sizes = []Size{
+	{Name: "original", MaxWidth: 1600},
+	{Name: "large", MaxWidth: 600},
+	{Name: "medium", MaxWidth: 300},
+	{Name: "small", MaxWidth: 120},
+}
+
+func IsSize(name string) bool {
+	for _, s := range Sizes {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Detect sniffs the image format from the leading bytes, ignoring whatever
+// the client claimed in Content-Type.
+func Detect(b []byte) (string, error) {
+	contentType := http.DetectContentType(b)
+	for _, t := range ContentTypes {
+		if contentType == t {
+			return contentType, nil
+		}
+	}
+	return "", ErrUnsupportedType
+}
+
+// Process decodes an upload and returns every size as JPEG, keyed by size
+// name, together with a short content hash used to version the URLs.
+func Process(b []byte) (map[string][]byte, string, error) {
+	contentType, err := Detect(b)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var decodeConfig func(io.Reader) (image.Config, error)
+	var decode func(io.Reader) (image.Image, error)
+	switch contentType {
+	case "image/jpeg":
+		decodeConfig, decode = jpeg.DecodeConfig, jpeg.Decode
+	case "image/png":
+		decodeConfig, decode = png.DecodeConfig, png.Decode
+	case "image/webp":
+		decodeConfig, decode = webp.DecodeConfig, webp.Decode
+	}
+
+	config, err := decodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", ErrInvalidImage
+	}
+	if config.Width < 1 || config.Height < 1 {
+		return nil, "", ErrInvalidImage
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	src, err := decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", ErrInvalidImage
+	}
+
+	sum := sha256.Sum256(b)
+	hash := hex.EncodeToString(sum[:8])
+
+	images := make(map[string][]byte, len(Sizes))
+	for _, size := range Sizes {
+		var buf bytes.Buffer
+		err = jpeg.Encode(&buf, resize(src, size.MaxWidth), &jpeg.Options{Quality: 85})
+		if err != nil {
+			return nil, "", err
+		}
+		images[size.Name] = buf.Bytes()
+	}
+
+	return images, hash, nil
+}
+
+// resize scales src down to maxWidth keeping the aspect ratio and flattens
+// any transparency onto white, since JPEG has no alpha channel.
+func resize(src image.Image, maxWidth int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxWidth {
+		height = max(1, height*maxWidth/width)
+		width = maxWidth
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
@@ -0,0 +1,424 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+var (
+	ErrDuplicateAuthor = errors.New("duplicate author")
+	ErrAuthorInUse     = errors.New("author in use")
+	ErrUnknownAuthor   = errors.New("unknown author")
+)
+
+const RoleAuthor = "author"
+
+var ContributorRoles = []string{RoleAuthor, "editor", "translator", "illustrator"}
+
+type Author struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Bio       string    `json:"bio"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+}
+
+// Contributor credits an author on a book. On input either AuthorID or Name
+// identifies the author; a name that is not known yet creates the author.
+type Contributor struct {
+	AuthorID int64  `json:"author_id"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	Position int    `json:"position"`
+}
+
+type AuthorCredit struct {
+	Book *Book  `json:"book"`
+	Role string `json:"role"`
+}
+
+func ValidateAuthor(v *validator.Validator, author *Author) {
+	v.Check(strings.TrimSpace(author.Name) != "", "name", "must be provided")
+	v.Check(len(author.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(author.Bio) <= 5000, "bio", "must not be more than 5000 bytes long")
+}
+
+func ValidateContributors(v *validator.Validator, contributors []Contributor) {
+	for _, c := range contributors {
+		v.Check(c.AuthorID > 0 || authorNameKey(c.Name) != "", "contributors", "each contributor needs an author_id or a name with a letter or digit")
+		v.Check(validator.PermittedValue(c.Role, ContributorRoles...), "contributors", "role must be author, editor, translator or illustrator")
+	}
+}
+
+// authorNameKey returns the key authors are matched on, as computed by the
+// authors.name_key column: the name's letters and digits, lower-cased. Names
+// without any would all share the empty key.
+func authorNameKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
+
+type AuthorModel struct {
+	DB *sql.DB
+}
+
+func (m AuthorModel) Insert(author *Author) error {
+	query := `
+		INSERT INTO authors (name, bio)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, author.Name, author.Bio).Scan(&author.ID, &author.CreatedAt, &author.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "authors_name_key_idx"`:
+			return ErrDuplicateAuthor
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m AuthorModel) Get(id int64) (*Author, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, name, bio, created_at, version
+		FROM authors
+		WHERE id = $1`
+
+	var author Author
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&author.ID, &author.Name, &author.Bio, &author.CreatedAt, &author.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &author, nil
+}
+
+// Update saves the author and renames them in the authors array of every
+// book they are credited on.
+func (m AuthorModel) Update(author *Author) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	err = tx.QueryRowContext(ctx, `SELECT name FROM authors WHERE id = $1`, author.ID).Scan(&oldName)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	query := `
+		UPDATE authors
+		SET name = $1, bio = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, author.Name, author.Bio, author.ID, author.Version).Scan(&author.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "authors_name_key_idx"`:
+			return ErrDuplicateAuthor
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if oldName != author.Name {
+		query = `
+			UPDATE books
+			SET authors = array_replace(authors, $1, $2)
+			WHERE id IN (SELECT book_id FROM book_authors WHERE author_id = $3)`
+
+		_, err = tx.ExecContext(ctx, query, oldName, author.Name, author.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes an author that is no longer credited on any book.
+func (m AuthorModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM authors
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrAuthorInUse
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m AuthorModel) GetAll(name string, filters Filters) ([]*Author, Metadata, error) {
+	args := []any{"%" + name + "%"}
+	keyset, keysetArgs := filters.keysetCondition(len(args) + 1)
+	args = append(args, keysetArgs...)
+
+	query := fmt.Sprintf(`
+		SELECT %s, id, name, bio, created_at, version, %s::text AS sort_value
+		FROM authors
+		WHERE (name ILIKE $1 OR $1 = '') %s
+		ORDER BY %s %s, id ASC
+		LIMIT $%d OFFSET $%d`, filters.countColumn(), filters.sortColumn(), keyset,
+		filters.sortColumn(), filters.sortDirection(), len(args)+1, len(args)+2)
+
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	authors := []*Author{}
+	values := []string{}
+
+	for rows.Next() {
+		var author Author
+		var value string
+		err := rows.Scan(&totalRecords, &author.ID, &author.Name, &author.Bio, &author.CreatedAt, &author.Version, &value)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		authors = append(authors, &author)
+		values = append(values, value)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if filters.Keyset {
+		authors, metadata := keysetPage(authors, values, filters, func(a *Author) int64 { return a.ID })
+		return authors, metadata, nil
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return authors, metadata, nil
+}
+
+// GetBooks lists the books an author is credited on, oldest first.
+func (m AuthorModel) GetBooks(authorID int64) ([]*AuthorCredit, error) {
+	query := `
+		SELECT ` + bookColumns + `, book_authors.role
+		FROM books
+		INNER JOIN book_authors ON book_authors.book_id = books.id
+		WHERE book_authors.author_id = $1
+		AND books.deleted_at IS NULL
+		ORDER BY books.publication_date ASC, books.id ASC, book_authors.role ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*AuthorCredit{}
+
+	for rows.Next() {
+		credit := AuthorCredit{Book: &Book{}}
+		err := rows.Scan(append(credit.Book.fields(), &credit.Role)...)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// loadContributors returns the credits of a book in display order.
+func loadContributors(ctx context.Context, q querier, bookID int64) ([]Contributor, error) {
+	query := `
+		SELECT authors.id, authors.name, book_authors.role, book_authors.position
+		FROM book_authors
+		INNER JOIN authors ON authors.id = book_authors.author_id
+		WHERE book_authors.book_id = $1
+		ORDER BY book_authors.position ASC, authors.id ASC`
+
+	rows, err := q.QueryContext(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contributors := []Contributor{}
+
+	for rows.Next() {
+		var c Contributor
+		err := rows.Scan(&c.AuthorID, &c.Name, &c.Role, &c.Position)
+		if err != nil {
+			return nil, err
+		}
+		contributors = append(contributors, c)
+	}
+
+	return contributors, rows.Err()
+}
+
+// syncContributors rewrites the book_authors rows of a saved book and the
+// denormalized books.authors array that listings, search and exports read.
+//
+// When book.Contributors is nil the credits are rebuilt from book.Authors:
+// the names become the author-role credits and any editors, translators or
+// illustrators already on the book are kept.
+func syncContributors(ctx context.Context, tx *sql.Tx, book *Book) error {
+	contributors := book.Contributors
+
+	if contributors == nil {
+		existing, err := loadContributors(ctx, tx, book.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range book.Authors {
+			contributors = append(contributors, Contributor{Name: name, Role: RoleAuthor})
+		}
+		for _, c := range existing {
+			if c.Role != RoleAuthor {
+				contributors = append(contributors, c)
+			}
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM book_authors WHERE book_id = $1`, book.ID)
+	if err != nil {
+		return err
+	}
+
+	resolved := []Contributor{}
+	names := []string{}
+	seen := make(map[string]bool)
+
+	for _, c := range contributors {
+		if c.AuthorID > 0 {
+			err = tx.QueryRowContext(ctx, `SELECT name FROM authors WHERE id = $1`, c.AuthorID).Scan(&c.Name)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrUnknownAuthor
+			}
+		} else {
+			query := `
+				INSERT INTO authors (name)
+				VALUES ($1)
+				ON CONFLICT (name_key) DO UPDATE SET name = authors.name
+				RETURNING id, name`
+
+			err = tx.QueryRowContext(ctx, query, strings.TrimSpace(c.Name)).Scan(&c.AuthorID, &c.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		key := fmt.Sprintf("%d/%s", c.AuthorID, c.Role)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		c.Position = len(resolved)
+		query := `
+			INSERT INTO book_authors (book_id, author_id, role, position)
+			VALUES ($1, $2, $3, $4)`
+
+		_, err = tx.ExecContext(ctx, query, book.ID, c.AuthorID, c.Role, c.Position)
+		if err != nil {
+			return err
+		}
+
+		resolved = append(resolved, c)
+		if c.Role == RoleAuthor {
+			names = append(names, c.Name)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE books SET authors = $1 WHERE id = $2`, pq.Array(names), book.ID)
+	if err != nil {
+		return err
+	}
+
+	book.Contributors = resolved
+	book.Authors = names
+	return nil
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
@@ -9,9 +9,12 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/tchenbz/test3AWT/internal/cover"
 	"github.com/tchenbz/test3AWT/internal/validator"
 )
 
+var ErrDuplicateISBN = errors.New("duplicate isbn")
+
 type Book struct {
     ID            int64     `json:"id"`
     Title         string    `json:"title"`
@@ -21,42 +24,158 @@ type Book struct {
     Genre         string    `json:"genre"`
     Description   string    `json:"description"`
     AverageRating float32   `json:"average_rating"`
+    RatingsCount  int32     `json:"ratings_count"`
+    RatingHistogram []int32 `json:"rating_histogram"` // reviews giving 1 to 5 stars
+    WeightedRating float32  `json:"weighted_rating"`
     CreatedAt     time.Time `json:"-"`
+    UpdatedAt     time.Time `json:"-"`
     Version       int32     `json:"version"`
+    WorkID        *int64    `json:"work_id,omitempty"`
+    Format        string    `json:"format,omitempty"`
+    Language      string    `json:"language,omitempty"`
+    Contributors  []Contributor `json:"contributors,omitempty"`
+    Series        *BookSeries   `json:"series,omitempty"`
+    CoverHash     string        `json:"-"`
 }
 
+var BookFormats = []string{"", "hardcover", "paperback", "ebook", "audiobook"}
+
 func (b *Book) MarshalJSON() ([]byte, error) {
     type Alias Book
     return json.Marshal(&struct {
-        Publication string `json:"publication_date"`
+        Publication string            `json:"publication_date"`
+        Covers      map[string]string `json:"covers,omitempty"`
         *Alias
     }{
         Publication: b.Publication.Format("2006-01-02"),
+        Covers:      b.coverURLs(),
         Alias:       (*Alias)(b),
     })
 }
 
+// coverURLs maps each cover size to its URL. The content hash in the query
+// string changes with every upload, so clients can cache the images hard.
+func (b *Book) coverURLs() map[string]string {
+    if b.CoverHash == "" {
+        return nil
+    }
+
+    urls := make(map[string]string, len(cover.Sizes))
+    for _, size := range cover.Sizes {
+        urls[size.Name] = fmt.Sprintf("/v1/books/%d/cover/%s?v=%s", b.ID, size.Name, b.CoverHash)
+    }
+    return urls
+}
+
+// CoverKey is the storage key of one size of a book's cover.
+func CoverKey(bookID int64, hash, size string) string {
+	return fmt.Sprintf("covers/%d/%s-%s.jpg", bookID, hash, size)
+}
+
+// bookColumns lists the books columns in the order expected by Book.fields.
+const bookColumns = `books.id, books.title, books.authors, books.isbn, books.publication_date,
+		books.genre, books.description, books.average_rating, books.created_at, books.version,
+		books.work_id, books.format, books.language, books.cover_hash, books.updated_at,
+		books.ratings_count, books.rating_histogram, books.weighted_rating`
+
+func (b *Book) fields() []any {
+	return []any{
+		&b.ID,
+		&b.Title,
+		pq.Array(&b.Authors),
+		&b.ISBN,
+		&b.Publication,
+		&b.Genre,
+		&b.Description,
+		&b.AverageRating,
+		&b.CreatedAt,
+		&b.Version,
+		&b.WorkID,
+		&b.Format,
+		&b.Language,
+		&b.CoverHash,
+		&b.UpdatedAt,
+		&b.RatingsCount,
+		pq.Array(&b.RatingHistogram),
+		&b.WeightedRating,
+	}
+}
+
 type BookModel struct {
 	DB *sql.DB
 }
 
-func (m BookModel) Insert(book *Book) error {
+// Insert saves a new book and records it as the first revision, credited to
+// userID.
+func (m BookModel) Insert(book *Book, userID int64) error {
     query := `
-        INSERT INTO books (title, authors, isbn, publication_date, genre, description)
-        VALUES ($1, $2, $3, $4, $5, $6)
-        RETURNING id, created_at, version`
+        INSERT INTO books (title, authors, isbn, publication_date, genre, description, format, language)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING id, created_at, version, updated_at, average_rating, ratings_count, rating_histogram, weighted_rating`
 
-    args := []interface{}{book.Title, pq.Array(book.Authors), book.ISBN, book.Publication, book.Genre, book.Description}
-    return m.DB.QueryRowContext(context.Background(), query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    tx, err := m.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    book.ISBN = canonicalISBN(book.ISBN)
+    args := []interface{}{book.Title, pq.Array(book.Authors), book.ISBN, book.Publication, book.Genre, book.Description, book.Format, book.Language}
+    err = tx.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version, &book.UpdatedAt,
+        &book.AverageRating, &book.RatingsCount, pq.Array(&book.RatingHistogram), &book.WeightedRating)
+    if err != nil {
+        switch {
+        case err.Error() == `pq: duplicate key value violates unique constraint "books_isbn_key"`:
+            return ErrDuplicateISBN
+        default:
+            return err
+        }
+    }
+
+    err = syncContributors(ctx, tx, book)
+    if err != nil {
+        return err
+    }
+
+    err = recordRevision(ctx, tx, book, userID)
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
 }
 
 func ValidateBook(v *validator.Validator, book *Book) {
 	v.Check(book.Title != "", "title", "must be provided")
-	v.Check(len(book.Authors) > 0, "authors", "must include at least one author")
+	if book.Contributors != nil {
+		v.Check(hasAuthorRole(book.Contributors), "contributors", "must include at least one author")
+	} else {
+		v.Check(len(book.Authors) > 0, "authors", "must include at least one author")
+		for _, name := range book.Authors {
+			v.Check(authorNameKey(name) != "", "authors", "must not contain names without a letter or digit")
+		}
+	}
 	v.Check(book.ISBN != "", "isbn", "must be provided")
+	_, validISBN := NormalizeISBN(book.ISBN)
+	v.Check(validISBN, "isbn", "must be a valid ISBN-10 or ISBN-13")
 	v.Check(book.Publication != time.Time{}, "publication_date", "must be provided")
 	v.Check(book.Genre != "", "genre", "must be provided")
 	v.Check(book.Description != "", "description", "must be provided")
+	v.Check(validator.PermittedValue(book.Format, BookFormats...), "format", "must be hardcover, paperback, ebook or audiobook")
+	v.Check(len(book.Language) <= 35, "language", "must not be more than 35 bytes long")
+	ValidateContributors(v, book.Contributors)
+}
+
+func hasAuthorRole(contributors []Contributor) bool {
+	for _, c := range contributors {
+		if c.Role == RoleAuthor {
+			return true
+		}
+	}
+	return false
 }
 
 func (m BookModel) Get(id int64) (*Book, error) {
@@ -65,28 +184,67 @@ func (m BookModel) Get(id int64) (*Book, error) {
 	}
 
 	query := `
-		SELECT id, title, authors, isbn, publication_date, genre, description, average_rating, created_at, version
+		SELECT ` + bookColumns + `
 		FROM books
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	var book Book
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&book.ID,
-		&book.Title,
-		pq.Array(&book.Authors),
-		&book.ISBN,
-		&book.Publication,
-		&book.Genre,
-		&book.Description,
-		&book.AverageRating,
-		&book.CreatedAt,
-		&book.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(book.fields()...)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = m.loadDetails(ctx, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	return &book, nil
+}
+
+// loadDetails fills in the book's contributors and series, which are kept
+// outside the books table.
+func (m BookModel) loadDetails(ctx context.Context, book *Book) error {
+	contributors, err := loadContributors(ctx, m.DB, book.ID)
+	if err != nil {
+		return err
+	}
+	if len(contributors) > 0 {
+		book.Contributors = contributors
+	}
+
+	book.Series, err = loadBookSeries(ctx, m.DB, book.ID)
+	return err
+}
+
+// GetByISBN looks a book up by ISBN-10 or ISBN-13, with or without hyphens.
+func (m BookModel) GetByISBN(isbn string) (*Book, error) {
+	isbn, ok := NormalizeISBN(isbn)
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + bookColumns + `
+		FROM books
+		WHERE isbn = $1 AND deleted_at IS NULL`
+
+	var book Book
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
+	err := m.DB.QueryRowContext(ctx, query, isbn).Scan(book.fields()...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -96,16 +254,25 @@ func (m BookModel) Get(id int64) (*Book, error) {
 		}
 	}
 
+	err = m.loadDetails(ctx, &book)
+	if err != nil {
+		return nil, err
+	}
+
 	return &book, nil
 }
 
-func (m BookModel) Update(book *Book) error {
+// Update saves the book and appends the new state to its revision history,
+// credited to userID.
+func (m BookModel) Update(book *Book, userID int64) error {
     query := `
         UPDATE books
-        SET title = $1, authors = $2, isbn = $3, publication_date = $4, genre = $5, description = $6, version = version + 1
-        WHERE id = $7
-        RETURNING version`
+        SET title = $1, authors = $2, isbn = $3, publication_date = $4, genre = $5, description = $6,
+            format = $7, language = $8, version = version + 1
+        WHERE id = $9 AND version = $10 AND deleted_at IS NULL
+        RETURNING version, updated_at`
 
+    book.ISBN = canonicalISBN(book.ISBN)
     args := []interface{}{
         book.Title,
         pq.Array(book.Authors),
@@ -113,25 +280,92 @@ func (m BookModel) Update(book *Book) error {
         book.Publication, 
         book.Genre,
         book.Description,
+        book.Format,
+        book.Language,
         book.ID,
+        book.Version,
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    tx, err := m.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    err = tx.QueryRowContext(ctx, query, args...).Scan(&book.Version, &book.UpdatedAt)
+    if err != nil {
+        switch {
+        case err.Error() == `pq: duplicate key value violates unique constraint "books_isbn_key"`:
+            return ErrDuplicateISBN
+        case errors.Is(err, sql.ErrNoRows):
+            return ErrEditConflict
+        default:
+            return err
+        }
     }
 
-    return m.DB.QueryRowContext(context.Background(), query, args...).Scan(&book.Version)
+    err = syncContributors(ctx, tx, book)
+    if err != nil {
+        return err
+    }
+
+    err = recordRevision(ctx, tx, book, userID)
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// SetCover records the hash of a newly stored cover. It does not bump the
+// version, since the cover is not part of the editable book record.
+func (m BookModel) SetCover(id int64, hash string) error {
+	query := `
+		UPDATE books
+		SET cover_hash = $1
+		WHERE id = $2 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, hash, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
 }
 
-func (m BookModel) Delete(id int64) error {
+// Delete moves the book to the trash if it is still at the given version,
+// returning ErrEditConflict if it changed or was deleted since it was read.
+// Its reviews and reading list entries are kept, hidden with it, until the
+// trash is purged.
+func (m BookModel) Delete(id int64, version int32) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
-		DELETE FROM books
-		WHERE id = $1`
+		UPDATE books
+		SET deleted_at = NOW()
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -142,25 +376,135 @@ func (m BookModel) Delete(id int64) error {
 	}
 
 	if rowsAffected == 0 {
-		return ErrRecordNotFound
+		return ErrEditConflict
 	}
 
 	return nil
 }
 
-func (m BookModel) GetAll(title, author, genre string, filters Filters) ([]*Book, Metadata, error) {
+// BookCriteria holds the catalog filters shared by book listings and facet
+// counts, so both always describe the same result set.
+type BookCriteria struct {
+	Title           string
+	Author          string
+	Genres          []string
+	PublishedAfter  time.Time
+	PublishedBefore time.Time
+	Fuzzy           bool
+}
+
+// where returns the WHERE clause for the criteria. It always uses
+// placeholders $1 to $5, so callers number any further arguments from $6.
+func (c BookCriteria) where() (string, []any) {
+	clause := `
+		WHERE (books.title ILIKE $1 OR $1 = '')
+		AND (books.authors @> ARRAY[$2]::TEXT[] OR $2 = '')`
+	title := "%" + c.Title + "%"
+
+	if c.Fuzzy {
+		clause = `
+		WHERE ($1 = '' OR $1 <% books.title)
+		AND ($2 = '' OR $2 <% books_authors_text(books.authors))`
+		title = c.Title
+	}
+
+	clause += `
+		AND (books.genre ILIKE ANY($3) OR cardinality($3::TEXT[]) = 0)
+		AND (books.publication_date >= $4 OR $4 IS NULL)
+		AND (books.publication_date <= $5 OR $5 IS NULL)
+		AND books.deleted_at IS NULL`
+
+	genres := make([]string, len(c.Genres))
+	for i, genre := range c.Genres {
+		genres[i] = "%" + genre + "%"
+	}
+
+	args := []any{title, c.Author, pq.Array(genres), nullTime(c.PublishedAfter), nullTime(c.PublishedBefore)}
+	return clause, args
+}
+
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func (m BookModel) GetAll(criteria BookCriteria, filters Filters) ([]*Book, Metadata, error) {
+	where, args := criteria.where()
+	keyset, keysetArgs := filters.keysetCondition(len(args) + 1)
+	args = append(args, keysetArgs...)
+
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, title, authors, isbn, publication_date, genre, description, average_rating, created_at, version
-		FROM books
-		WHERE (title ILIKE $1 OR $1 = '')
-		AND (authors @> ARRAY[$2]::TEXT[] OR $2 = '')
-		AND (genre ILIKE $3 OR $3 = '')
+		SELECT %s, ` + bookColumns + `, %s::text AS sort_value
+		FROM books %s %s
 		ORDER BY %s %s, id ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+		LIMIT $%d OFFSET $%d`, filters.countColumn(), filters.sortColumn(), where, keyset,
+		filters.sortColumn(), filters.sortDirection(), len(args)+1, len(args)+2)
+
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []*Book{}
+	values := []string{}
+
+	for rows.Next() {
+		var book Book
+		var value string
+		dest := append([]any{&totalRecords}, book.fields()...)
+		err := rows.Scan(append(dest, &value)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		books = append(books, &book)
+		values = append(values, value)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if filters.Keyset {
+		books, metadata := keysetPage(books, values, filters, func(b *Book) int64 { return b.ID })
+		return books, metadata, nil
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return books, metadata, nil
+}
+
+type BookSearchResult struct {
+	Book      *Book   `json:"book"`
+	Relevance float32 `json:"relevance"`
+	Headline  string  `json:"headline"`
+}
+
+// Search runs a full-text query against the weighted search_vector column.
+// The query string uses websearch syntax, so "quoted phrases" and -negation work.
+func (m BookModel) Search(q, genre string, filters Filters) ([]*BookSearchResult, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), ` + bookColumns + `,
+			ts_rank(books.search_vector, tsq) AS relevance,
+			ts_headline('english', coalesce(books.description, ''), tsq,
+				'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10') AS headline
+		FROM books, websearch_to_tsquery('english', $1) tsq
+		WHERE books.search_vector @@ tsq
+		AND books.deleted_at IS NULL
+		AND (books.genre ILIKE $2 OR $2 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 
 	args := []interface{}{
-		"%" + title + "%",
-		author,
+		q,
 		"%" + genre + "%",
 		filters.limit(),
 		filters.offset(),
@@ -176,27 +520,16 @@ func (m BookModel) GetAll(title, author, genre string, filters Filters) ([]*Book
 	defer rows.Close()
 
 	totalRecords := 0
-	books := []*Book{}
+	results := []*BookSearchResult{}
 
 	for rows.Next() {
-		var book Book
-		err := rows.Scan(
-			&totalRecords,
-			&book.ID,
-			&book.Title,
-			pq.Array(&book.Authors),
-			&book.ISBN,
-			&book.Publication,
-			&book.Genre,
-			&book.Description,
-			&book.AverageRating,
-			&book.CreatedAt,
-			&book.Version,
-		)
+		result := BookSearchResult{Book: &Book{}}
+		dest := append([]any{&totalRecords}, result.Book.fields()...)
+		err := rows.Scan(append(dest, &result.Relevance, &result.Headline)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
-		books = append(books, &book)
+		results = append(results, &result)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -204,6 +537,158 @@ func (m BookModel) GetAll(title, author, genre string, filters Filters) ([]*Book
 	}
 
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
-	return books, metadata, nil
+	return results, metadata, nil
+}
+
+type BookMatch struct {
+	Book       *Book   `json:"book"`
+	Similarity float32 `json:"similarity"`
+}
+
+type BookSuggestions struct {
+	Titles  []string `json:"titles"`
+	Authors []string `json:"authors"`
 }
 
+// GetAllFuzzy matches title and author by trigram word similarity instead of
+// substring/exact comparison, so misspellings still find the book.
+func (m BookModel) GetAllFuzzy(criteria BookCriteria, filters Filters) ([]*BookMatch, Metadata, error) {
+	criteria.Fuzzy = true
+	where, args := criteria.where()
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), ` + bookColumns + `,
+			GREATEST(
+				CASE WHEN $1 = '' THEN 0 ELSE word_similarity($1, books.title) END,
+				CASE WHEN $2 = '' THEN 0 ELSE (SELECT COALESCE(MAX(word_similarity($2, a)), 0) FROM unnest(books.authors) a) END
+			) AS similarity
+		FROM books %s
+		ORDER BY %s %s, id ASC
+		LIMIT $6 OFFSET $7`, where, filters.sortColumn(), filters.sortDirection())
+
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	matches := []*BookMatch{}
+
+	for rows.Next() {
+		match := BookMatch{Book: &Book{}}
+		dest := append([]any{&totalRecords}, match.Book.fields()...)
+		err := rows.Scan(append(dest, &match.Similarity)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		matches = append(matches, &match)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return matches, metadata, nil
+}
+
+// Suggest returns the closest known titles and author names for a "did you
+// mean" prompt. It uses a looser threshold than GetAllFuzzy.
+func (m BookModel) Suggest(title, author string) (*BookSuggestions, error) {
+	suggestions := &BookSuggestions{Titles: []string{}, Authors: []string{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if title != "" {
+		query := `
+			SELECT title
+			FROM books
+			WHERE word_similarity($1, title) > 0.3
+			AND deleted_at IS NULL
+			ORDER BY word_similarity($1, title) DESC, title ASC
+			LIMIT 5`
+
+		err := m.collectStrings(ctx, &suggestions.Titles, query, title)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if author != "" {
+		query := `
+			SELECT name
+			FROM (SELECT DISTINCT unnest(authors) AS name FROM books WHERE deleted_at IS NULL) names
+			WHERE similarity(name, $1) > 0.2
+			ORDER BY similarity(name, $1) DESC, name ASC
+			LIMIT 5`
+
+		err := m.collectStrings(ctx, &suggestions.Authors, query, author)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return suggestions, nil
+}
+
+func (m BookModel) collectStrings(ctx context.Context, dst *[]string, query string, args ...any) error {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		if err != nil {
+			return err
+		}
+		*dst = append(*dst, value)
+	}
+
+	return rows.Err()
+}
+
+// Stream calls fn for every book matching criteria, in id order, without
+// loading the whole result set into memory. The query stops when ctx is
+// cancelled, such as when the client goes away.
+func (m BookModel) Stream(ctx context.Context, criteria BookCriteria, fn func(*Book) error) error {
+	where, args := criteria.where()
+
+	query := `
+		SELECT ` + bookColumns + `
+		FROM books ` + where + `
+		ORDER BY id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var book Book
+		err := rows.Scan(book.fields()...)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&book)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ImportCreated  = "created"
+	ImportUpdated  = "updated"
+	ImportRejected = "rejected"
+)
+
+type ImportResult struct {
+	Row    int               `json:"row"`
+	Status string            `json:"status"`
+	ID     int64             `json:"id,omitempty"`
+	ISBN   string            `json:"isbn,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun    bool            `json:"dry_run"`
+	Atomic    bool            `json:"atomic"`
+	Committed bool            `json:"committed"`
+	Created   int             `json:"created"`
+	Updated   int             `json:"updated"`
+	Rejected  int             `json:"rejected"`
+	Rows      []*ImportResult `json:"rows"`
+}
+
+// Import upserts books on ISBN inside one transaction. books and results are
+// parallel slices: a nil book marks a row the caller already rejected. Every
+// row runs under its own savepoint so a database error only rejects that row.
+// In atomic mode any rejection rolls the whole import back, and a dry run
+// always rolls back, so the report shows what would have happened. Every
+// saved row is recorded as a revision credited to userID.
+func (m BookModel) Import(books []*Book, results []*ImportResult, atomic, dryRun bool, userID int64) (*ImportReport, error) {
+	report := &ImportReport{DryRun: dryRun, Atomic: atomic, Rows: results}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO books (title, authors, isbn, publication_date, genre, description)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (isbn) WHERE deleted_at IS NULL DO UPDATE
+		SET title = EXCLUDED.title, authors = EXCLUDED.authors, publication_date = EXCLUDED.publication_date,
+			genre = EXCLUDED.genre, description = EXCLUDED.description, version = books.version + 1
+		RETURNING id, created_at, version, updated_at, format, language, (xmax = 0)`
+
+	for i, book := range books {
+		result := results[i]
+		if book == nil {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, "SAVEPOINT import_row")
+		if err != nil {
+			return nil, err
+		}
+
+		var inserted bool
+		book.ISBN = canonicalISBN(book.ISBN)
+		result.ISBN = book.ISBN
+		args := []any{book.Title, pq.Array(book.Authors), book.ISBN, book.Publication, book.Genre, book.Description}
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version, &book.UpdatedAt, &book.Format, &book.Language, &inserted)
+		if err == nil {
+			err = syncContributors(ctx, tx, book)
+		}
+		if err == nil {
+			err = recordRevision(ctx, tx, book, userID)
+		}
+		if err != nil {
+			var pqErr *pq.Error
+			if !errors.As(err, &pqErr) {
+				return nil, err
+			}
+
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_row")
+			if err != nil {
+				return nil, err
+			}
+
+			result.Status = ImportRejected
+			result.Errors = map[string]string{"database": pqErr.Message}
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT import_row")
+		if err != nil {
+			return nil, err
+		}
+
+		result.ID = book.ID
+		result.Status = ImportUpdated
+		if inserted {
+			result.Status = ImportCreated
+		}
+	}
+
+	for _, result := range results {
+		switch result.Status {
+		case ImportCreated:
+			report.Created++
+		case ImportUpdated:
+			report.Updated++
+		default:
+			report.Rejected++
+		}
+	}
+
+	if dryRun || (atomic && report.Rejected > 0) {
+		return report, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	report.Committed = true
+	return report, nil
+}
@@ -0,0 +1,199 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// BookSnapshot holds the editable fields of a book as they were at one
+// version.
+type BookSnapshot struct {
+	Title        string        `json:"title"`
+	Authors      []string      `json:"authors"`
+	ISBN         string        `json:"isbn"`
+	Publication  string        `json:"publication_date"`
+	Genre        string        `json:"genre"`
+	Description  string        `json:"description"`
+	Format       string        `json:"format"`
+	Language     string        `json:"language"`
+	Contributors []Contributor `json:"contributors"`
+}
+
+// snapshotFields fixes the order changes are reported in.
+var snapshotFields = []string{"title", "authors", "isbn", "publication_date", "genre", "description", "format", "language", "contributors"}
+
+func snapshotOf(book *Book) BookSnapshot {
+	return BookSnapshot{
+		Title:        book.Title,
+		Authors:      book.Authors,
+		ISBN:         book.ISBN,
+		Publication:  book.Publication.Format("2006-01-02"),
+		Genre:        book.Genre,
+		Description:  book.Description,
+		Format:       book.Format,
+		Language:     book.Language,
+		Contributors: book.Contributors,
+	}
+}
+
+// Apply copies the snapshot onto book, leaving its id and version alone.
+func (s BookSnapshot) Apply(book *Book) error {
+	publication, err := time.Parse("2006-01-02", s.Publication)
+	if err != nil {
+		return err
+	}
+
+	book.Title = s.Title
+	book.Authors = s.Authors
+	book.ISBN = s.ISBN
+	book.Publication = publication
+	book.Genre = s.Genre
+	book.Description = s.Description
+	book.Format = s.Format
+	book.Language = s.Language
+	book.Contributors = s.Contributors
+	return nil
+}
+
+type BookRevision struct {
+	Version   int32         `json:"version"`
+	UserID    *int64        `json:"user_id"`
+	Username  *string       `json:"username"`
+	CreatedAt time.Time     `json:"created_at"`
+	Snapshot  BookSnapshot  `json:"-"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// FieldChange is one field that differs from the previous revision. From is
+// null on the first revision.
+type FieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+// recordRevision appends the saved state of book to its history. It runs in
+// the transaction that saved the book, so the two cannot disagree. A userID
+// of zero records no author.
+func recordRevision(ctx context.Context, tx *sql.Tx, book *Book, userID int64) error {
+	snapshot, err := json.Marshal(snapshotOf(book))
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO book_revisions (book_id, version, user_id, snapshot)
+		VALUES ($1, $2, NULLIF($3, 0), $4)`
+
+	_, err = tx.ExecContext(ctx, query, book.ID, book.Version, userID, snapshot)
+	return err
+}
+
+// GetRevisions returns the history of a book, oldest first, with each
+// revision's changes against the one before it.
+func (m BookModel) GetRevisions(bookID int64) ([]*BookRevision, error) {
+	query := `
+		SELECT book_revisions.version, book_revisions.user_id, users.username,
+			book_revisions.created_at, book_revisions.snapshot
+		FROM book_revisions
+		LEFT JOIN users ON users.id = book_revisions.user_id
+		WHERE book_revisions.book_id = $1
+		ORDER BY book_revisions.version ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*BookRevision{}
+	var previous map[string]json.RawMessage
+
+	for rows.Next() {
+		var revision BookRevision
+		var snapshot []byte
+		err := rows.Scan(&revision.Version, &revision.UserID, &revision.Username, &revision.CreatedAt, &snapshot)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(snapshot, &revision.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+
+		var current map[string]json.RawMessage
+		err = json.Unmarshal(snapshot, &current)
+		if err != nil {
+			return nil, err
+		}
+
+		revision.Changes = diffSnapshots(previous, current)
+		previous = current
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetRevision returns the snapshot a book had at version.
+func (m BookModel) GetRevision(bookID int64, version int32) (*BookRevision, error) {
+	query := `
+		SELECT book_revisions.version, book_revisions.user_id, users.username,
+			book_revisions.created_at, book_revisions.snapshot
+		FROM book_revisions
+		LEFT JOIN users ON users.id = book_revisions.user_id
+		WHERE book_revisions.book_id = $1 AND book_revisions.version = $2`
+
+	var revision BookRevision
+	var snapshot []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, bookID, version).Scan(&revision.Version, &revision.UserID, &revision.Username, &revision.CreatedAt, &snapshot)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(snapshot, &revision.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+func diffSnapshots(previous, current map[string]json.RawMessage) []FieldChange {
+	changes := []FieldChange{}
+	for _, field := range snapshotFields {
+		from, to := previous[field], current[field]
+		if from == nil {
+			from = json.RawMessage("null")
+		}
+		if to == nil {
+			to = json.RawMessage("null")
+		}
+		if bytes.Equal(from, to) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field, From: from, To: to})
+	}
+	return changes
+}
@@ -0,0 +1,103 @@
+package data
+
+import (
+	"slices"
+
+	"github.com/tchenbz/test3AWT/internal/cache"
+)
+
+// CachedBookModel is a BookModel whose Get is served from an in-process
+// cache. Writes made through it invalidate the books they touch; changes
+// made elsewhere, such as renaming an author or a series, must call
+// Invalidate or InvalidateAll, or wait for entries to expire.
+type CachedBookModel struct {
+	BookModel
+	Cache *cache.Cache[int64, *Book]
+}
+
+// Get returns a copy of the book, so callers may change it freely.
+func (m CachedBookModel) Get(id int64) (*Book, error) {
+	if book, ok := m.Cache.Get(id); ok {
+		return book.clone(), nil
+	}
+
+	stamp := m.Cache.Stamp()
+	book, err := m.BookModel.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Cache.Fill(stamp, id, book.clone())
+	return book, nil
+}
+
+func (m CachedBookModel) Update(book *Book, userID int64) error {
+	defer m.Invalidate(book.ID)
+	return m.BookModel.Update(book, userID)
+}
+
+func (m CachedBookModel) SetCover(id int64, hash string) error {
+	defer m.Invalidate(id)
+	return m.BookModel.SetCover(id, hash)
+}
+
+func (m CachedBookModel) Delete(id int64, version int32) error {
+	defer m.Invalidate(id)
+	return m.BookModel.Delete(id, version)
+}
+
+func (m CachedBookModel) Import(books []*Book, results []*ImportResult, atomic, dryRun bool, userID int64) (*ImportReport, error) {
+	defer m.InvalidateAll()
+	return m.BookModel.Import(books, results, atomic, dryRun, userID)
+}
+
+func (m CachedBookModel) Invalidate(ids ...int64) {
+	m.Cache.Delete(ids...)
+}
+
+func (m CachedBookModel) InvalidateAll() {
+	m.Cache.Purge()
+}
+
+func (b *Book) clone() *Book {
+	c := *b
+	c.Authors = slices.Clone(b.Authors)
+	c.Contributors = slices.Clone(b.Contributors)
+	c.RatingHistogram = slices.Clone(b.RatingHistogram)
+	if b.WorkID != nil {
+		workID := *b.WorkID
+		c.WorkID = &workID
+	}
+	if b.Series != nil {
+		series := *b.Series
+		c.Series = &series
+	}
+	return &c
+}
+
+// CachedPermissionModel is a PermissionModel that remembers each user's
+// permissions, which are checked on almost every request.
+type CachedPermissionModel struct {
+	PermissionModel
+	Cache *cache.Cache[int64, Permissions]
+}
+
+func (m CachedPermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	if permissions, ok := m.Cache.Get(userID); ok {
+		return slices.Clone(permissions), nil
+	}
+
+	stamp := m.Cache.Stamp()
+	permissions, err := m.PermissionModel.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Cache.Fill(stamp, userID, slices.Clone(permissions))
+	return permissions, nil
+}
+
+func (m CachedPermissionModel) AddForUser(userID int64, codes ...string) error {
+	defer m.Cache.Delete(userID)
+	return m.PermissionModel.AddForUser(userID, codes...)
+}
@@ -0,0 +1,322 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+var ErrUnknownParent = errors.New("parent comment not found")
+
+// Comment is a comment on a review. Replies carry the id of the comment they
+// answer and are nested under it when threads are listed. A deleted comment
+// that still has replies is kept in its thread with its content removed.
+type Comment struct {
+	ID        int64      `json:"id"`
+	ReviewID  int64      `json:"review_id"`
+	ParentID  *int64     `json:"parent_id"`
+	UserID    int64      `json:"user_id"`
+	Author    string     `json:"author"`
+	Content   string     `json:"content"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Version   int32      `json:"version"`
+	Replies   []*Comment `json:"replies"`
+}
+
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Check(strings.TrimSpace(comment.Content) != "", "content", "must be provided")
+	v.Check(len(comment.Content) <= 5000, "content", "must not be more than 5000 bytes long")
+}
+
+// commentColumns lists the review_comments columns in the order expected by
+// Comment.fields.
+const commentColumns = `review_comments.id, review_comments.review_id, review_comments.parent_id,
+		review_comments.user_id, (SELECT users.username FROM users WHERE users.id = review_comments.user_id),
+		review_comments.content, review_comments.deleted_at IS NOT NULL, review_comments.created_at,
+		review_comments.updated_at, review_comments.version`
+
+func (c *Comment) fields() []any {
+	return []any{
+		&c.ID,
+		&c.ReviewID,
+		&c.ParentID,
+		&c.UserID,
+		&c.Author,
+		&c.Content,
+		&c.Deleted,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.Version,
+	}
+}
+
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// Insert saves a new comment. A reply must answer a comment on the same
+// review that has not been deleted, or ErrUnknownParent is returned.
+func (m CommentModel) Insert(comment *Comment) error {
+	query := `
+		INSERT INTO review_comments (review_id, user_id, content)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at, version`
+	args := []any{comment.ReviewID, comment.UserID, comment.Content}
+
+	if comment.ParentID != nil {
+		query = `
+			INSERT INTO review_comments (review_id, user_id, content, parent_id, root_id)
+			SELECT $1, $2, $3, parent.id, COALESCE(parent.root_id, parent.id)
+			FROM review_comments AS parent
+			WHERE parent.id = $4 AND parent.review_id = $1 AND parent.deleted_at IS NULL
+			RETURNING id, created_at, updated_at, version`
+		args = append(args, *comment.ParentID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt, &comment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrUnknownParent
+		default:
+			return err
+		}
+	}
+
+	comment.Replies = []*Comment{}
+	return nil
+}
+
+func (m CommentModel) Get(id int64) (*Comment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + commentColumns + `
+		FROM review_comments
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	var comment Comment
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(comment.fields()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	comment.Replies = []*Comment{}
+	return &comment, nil
+}
+
+func (m CommentModel) Update(comment *Comment) error {
+	query := `
+		UPDATE review_comments
+		SET content = $1, version = version + 1
+		WHERE id = $2 AND version = $3 AND deleted_at IS NULL
+		RETURNING version, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, comment.Content, comment.ID, comment.Version).Scan(&comment.Version, &comment.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the comment if it is still at the given version. Its
+// replies stay in the thread.
+func (m CommentModel) Delete(id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE review_comments
+		SET deleted_at = NOW()
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// GetThreads returns a page of a review's top-level comments, each with all
+// of its replies nested beneath it in the order they were posted. Only the
+// top-level comments are paginated and sorted by filters.
+func (m CommentModel) GetThreads(reviewID int64, filters Filters) ([]*Comment, Metadata, error) {
+	keyset, keysetArgs := filters.keysetCondition(2)
+	args := append([]any{reviewID}, keysetArgs...)
+
+	query := fmt.Sprintf(`
+		SELECT %s, `+commentColumns+`, %s::text AS sort_value
+		FROM review_comments
+		WHERE review_id = $1 AND parent_id IS NULL
+		AND (deleted_at IS NULL OR EXISTS (
+			SELECT 1 FROM review_comments AS replies
+			WHERE replies.root_id = review_comments.id AND replies.deleted_at IS NULL))
+		%s
+		ORDER BY %s %s, id ASC
+		LIMIT $%d OFFSET $%d`, filters.countColumn(), filters.sortColumn(), keyset,
+		filters.sortColumn(), filters.sortDirection(), len(args)+1, len(args)+2)
+
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	threads := []*Comment{}
+	values := []string{}
+
+	for rows.Next() {
+		comment := &Comment{Replies: []*Comment{}}
+		var value string
+		dest := append([]any{&totalRecords}, comment.fields()...)
+		err := rows.Scan(append(dest, &value)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		threads = append(threads, comment)
+		values = append(values, value)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var metadata Metadata
+	if filters.Keyset {
+		threads, metadata = keysetPage(threads, values, filters, func(c *Comment) int64 { return c.ID })
+	} else {
+		metadata = calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	}
+
+	err = m.loadReplies(ctx, threads)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return threads, metadata, nil
+}
+
+// loadReplies nests every reply to the given top-level comments under its
+// parent and drops deleted replies that have nothing left beneath them.
+func (m CommentModel) loadReplies(ctx context.Context, threads []*Comment) error {
+	if len(threads) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Comment)
+	ids := make([]int64, len(threads))
+	for i, thread := range threads {
+		byID[thread.ID] = thread
+		ids[i] = thread.ID
+	}
+
+	// Replies are always newer than their parent, so in id order every
+	// parent is seen before its replies.
+	query := `
+		SELECT ` + commentColumns + `
+		FROM review_comments
+		WHERE root_id = ANY($1)
+		ORDER BY id ASC`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		reply := &Comment{Replies: []*Comment{}}
+		err := rows.Scan(reply.fields()...)
+		if err != nil {
+			return err
+		}
+
+		parent, ok := byID[*reply.ParentID]
+		if !ok {
+			continue
+		}
+		parent.Replies = append(parent.Replies, reply)
+		byID[reply.ID] = reply
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, thread := range threads {
+		prune(thread)
+	}
+
+	return nil
+}
+
+// prune drops deleted replies with no remaining replies of their own, blanks
+// what is left of deleted comments, and reports whether c should stay.
+func prune(c *Comment) bool {
+	kept := c.Replies[:0]
+	for _, reply := range c.Replies {
+		if prune(reply) {
+			kept = append(kept, reply)
+		}
+	}
+	c.Replies = kept
+
+	if c.Deleted {
+		c.Content = ""
+		c.Author = ""
+		c.UserID = 0
+	}
+
+	return !c.Deleted || len(kept) > 0
+}
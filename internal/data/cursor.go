@@ -0,0 +1,70 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var cursorKey []byte
+
+// SetCursorKey sets the secret used to sign pagination cursors. Cursors
+// signed with a different key are rejected.
+func SetCursorKey(key []byte) {
+	cursorKey = key
+}
+
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"i"`
+}
+
+func encodeCursor(c cursor) string {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+
+	mac := hmac.New(sha256.New, cursorKey)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	encodedPayload, encodedSignature, found := strings.Cut(s, ".")
+	if !found {
+		return c, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, cursorKey)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(payload, &c)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
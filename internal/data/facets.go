@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var FacetSafeList = []string{"genre", "author", "decade", "rating_bucket"}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type Facets map[string][]FacetCount
+
+// facetQueries maps each facet name to the value expression it groups by,
+// any extra FROM items it needs, and how its buckets are ordered.
+var facetQueries = map[string]struct {
+	value   string
+	from    string
+	orderBy string
+}{
+	"genre": {
+		value:   "COALESCE(books.genre, '')",
+		orderBy: "2 DESC, 1 ASC",
+	},
+	"author": {
+		value:   "author",
+		from:    "CROSS JOIN LATERAL unnest(books.authors) AS author",
+		orderBy: "2 DESC, 1 ASC",
+	},
+	"decade": {
+		value:   "((EXTRACT(YEAR FROM books.publication_date)::int / 10) * 10)::text || 's'",
+		orderBy: "1 ASC",
+	},
+	"rating_bucket": {
+		value:   "LEAST(FLOOR(COALESCE(books.average_rating, 0))::int, 4)::text || '-' || (LEAST(FLOOR(COALESCE(books.average_rating, 0))::int, 4) + 1)::text",
+		orderBy: "1 ASC",
+	},
+}
+
+// Facets counts the books matching criteria, grouped by each requested facet.
+func (m BookModel) Facets(criteria BookCriteria, names []string) (Facets, error) {
+	where, args := criteria.where()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	facets := Facets{}
+
+	for _, name := range names {
+		facet, ok := facetQueries[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown facet: %s", name)
+		}
+
+		query := fmt.Sprintf(`
+			SELECT %s, COUNT(*)
+			FROM books %s %s
+			GROUP BY 1
+			ORDER BY %s
+			LIMIT 50`, facet.value, facet.from, where, facet.orderBy)
+
+		rows, err := m.DB.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		counts := []FacetCount{}
+		for rows.Next() {
+			var count FacetCount
+			err = rows.Scan(&count.Value, &count.Count)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			counts = append(counts, count)
+		}
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+
+		facets[name] = counts
+	}
+
+	return facets, nil
+}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/tchenbz/test3AWT/internal/validator"
@@ -11,32 +12,85 @@ type Filters struct {
 	PageSize     int      
 	Sort         string   
 	SortSafeList []string 
+	Keyset       bool   // cursor pagination was requested
+	Cursor       string // next_cursor from the previous page, empty for the first page
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 500, "page", "must not exceed 500")
+	if !f.Keyset {
+		v.Check(f.Page > 0, "page", "must be greater than zero")
+		v.Check(f.Page <= 500, "page", "must not exceed 500")
+	}
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+
+	if f.Keyset && f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		v.Check(err == nil && c.Sort == f.Sort, "cursor", "invalid or expired cursor")
+	}
 }
 
+// limit fetches one extra row in keyset mode so we know whether a next page exists.
 func (f Filters) limit() int {
+	if f.Keyset {
+		return f.PageSize + 1
+	}
 	return f.PageSize
 }
 
 func (f Filters) offset() int {
+	if f.Keyset {
+		return 0
+	}
 	return (f.Page - 1) * f.PageSize
 }
 
+// countColumn skips the COUNT(*) OVER() window in keyset mode, where the
+// total is never reported.
+func (f Filters) countColumn() string {
+	if f.Keyset {
+		return "0"
+	}
+	return "COUNT(*) OVER()"
+}
+
+// keysetCondition restricts a query to the rows after the cursor, numbering
+// its placeholders from next. Rows are ordered by the sort column and then by
+// id ascending, so the id only breaks ties.
+func (f Filters) keysetCondition(next int) (string, []any) {
+	if !f.Keyset || f.Cursor == "" {
+		return "", nil
+	}
+
+	c, err := decodeCursor(f.Cursor)
+	if err != nil {
+		panic("unvalidated cursor parameter: " + f.Cursor)
+	}
+
+	column := f.sortColumn()
+	comparison := ">"
+	if f.sortDirection() == "DESC" {
+		comparison = "<"
+	}
+
+	if column == "id" {
+		return fmt.Sprintf("AND id %s $%d", comparison, next), []any{c.ID}
+	}
+
+	clause := fmt.Sprintf("AND (%[1]s %[2]s $%[3]d OR (%[1]s = $%[3]d AND id > $%[4]d))", column, comparison, next, next+1)
+	return clause, []any{c.Value, c.ID}
+}
+
 func (f Filters) sortColumn() string {
 	for _, safeValue := range f.SortSafeList {
 		if f.Sort == safeValue {
@@ -53,6 +107,20 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+// keysetPage trims the look-ahead row and, if there was one, sets the cursor
+// for the next page. values holds the sort column of each item as text.
+func keysetPage[T any](items []T, values []string, f Filters, id func(T) int64) ([]T, Metadata) {
+	metadata := Metadata{PageSize: f.PageSize}
+
+	if len(items) > f.PageSize {
+		items = items[:f.PageSize]
+		last := len(items) - 1
+		metadata.NextCursor = encodeCursor(cursor{Sort: f.Sort, Value: values[last], ID: id(items[last])})
+	}
+
+	return items, metadata
+}
+
 func calculateMetaData(totalRecords int, currentPage int, pageSize int) Metadata {
 	if totalRecords == 0 {
 		return Metadata{}
@@ -0,0 +1,76 @@
+package data
+
+import "strings"
+
+// NormalizeISBN strips hyphens and spaces from an ISBN-10 or ISBN-13, checks
+// its check digit and returns the canonical ISBN-13 form. ok is false if s is
+// not a valid ISBN.
+func NormalizeISBN(s string) (isbn string, ok bool) {
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s))
+
+	switch len(digits) {
+	case 10:
+		if !validISBN10(digits) {
+			return "", false
+		}
+		body := "978" + digits[:9]
+		return body + string(isbn13CheckDigit(body)), true
+	case 13:
+		if !isDigits(digits) || isbn13CheckDigit(digits[:12]) != digits[12] {
+			return "", false
+		}
+		return digits, true
+	default:
+		return "", false
+	}
+}
+
+func validISBN10(digits string) bool {
+	sum := 0
+	for i := 0; i < 10; i++ {
+		c := digits[i]
+		var value int
+		switch {
+		case c >= '0' && c <= '9':
+			value = int(c - '0')
+		case c == 'X' && i == 9:
+			value = 10
+		default:
+			return false
+		}
+		sum += value * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+// isbn13CheckDigit computes the check digit for the first 12 digits of an ISBN-13.
+func isbn13CheckDigit(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(body[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalISBN returns the ISBN-13 form of isbn, or isbn unchanged if it is
+// not valid (ValidateBook reports that case).
+func canonicalISBN(isbn string) string {
+	normalized, ok := NormalizeISBN(isbn)
+	if !ok {
+		return isbn
+	}
+	return normalized
+}
@@ -0,0 +1,375 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+// Moderation statuses of a review. Visible and pending reviews are shown to
+// everyone; held ones, which the content filter stopped until a moderator
+// looks at them, and hidden ones only to their author; removed ones to
+// nobody but moderators.
+const (
+	ModerationVisible = "visible"
+	ModerationPending = "pending"
+	ModerationHeld    = "held"
+	ModerationHidden  = "hidden"
+	ModerationRemoved = "removed"
+)
+
+var ModerationStatuses = []string{ModerationVisible, ModerationPending, ModerationHeld, ModerationHidden, ModerationRemoved}
+
+// reviewVisible restricts a reviews query to reviews shown to everyone.
+const reviewVisible = `reviews.moderation_status IN ('visible', 'pending')`
+
+// Actions a moderator can take on a review, and the status each leads to.
+const (
+	ModerationHide    = "hide"
+	ModerationRestore = "restore"
+	ModerationRemove  = "remove"
+)
+
+var moderationOutcomes = map[string]string{
+	ModerationHide:    ModerationHidden,
+	ModerationRestore: ModerationVisible,
+	ModerationRemove:  ModerationRemoved,
+}
+
+var ModerationActions = []string{ModerationHide, ModerationRestore, ModerationRemove}
+
+var ReportReasons = []string{"spam", "harassment", "hate_speech", "spoilers", "off_topic", "other"}
+
+// ReportThreshold is the number of open reports that puts a visible review
+// in the moderation queue as pending.
+const ReportThreshold = 3
+
+type Report struct {
+	ID        int64     `json:"id"`
+	ReviewID  int64     `json:"review_id"`
+	UserID    int64     `json:"user_id"`
+	Reason    string    `json:"reason"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Resolved  bool      `json:"resolved"`
+}
+
+func ValidateReport(v *validator.Validator, report *Report) {
+	v.Check(validator.PermittedValue(report.Reason, ReportReasons...), "reason", "must be one of spam, harassment, hate_speech, spoilers, off_topic or other")
+	v.Check(report.Reason != "other" || report.Details != "", "details", "must be provided when the reason is other")
+	v.Check(len(report.Details) <= 1000, "details", "must not be more than 1000 bytes long")
+}
+
+// ModerationAction records a moderator's decision on a review.
+type ModerationAction struct {
+	ID          int64     `json:"id"`
+	ModeratorID *int64    `json:"moderator_id"`
+	Moderator   *string   `json:"moderator"`
+	Action      string    `json:"action"`
+	FromStatus  string    `json:"from_status"`
+	ToStatus    string    `json:"to_status"`
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func ValidateModerationNote(v *validator.Validator, note string) {
+	v.Check(note != "", "note", "must be provided")
+	v.Check(len(note) <= 2000, "note", "must not be more than 2000 bytes long")
+}
+
+// QueueItem is a review awaiting a moderator, with a summary of its open
+// reports.
+type QueueItem struct {
+	Review          *Review    `json:"review"`
+	OpenReports     int        `json:"open_reports"`
+	Reasons         []string   `json:"reasons"`
+	FirstReportedAt *time.Time `json:"first_reported_at"`
+}
+
+type ModerationModel struct {
+	DB *sql.DB
+}
+
+// Report files the user's report against a review, replacing their earlier
+// open report if they have one. A review reaching ReportThreshold open
+// reports becomes pending.
+func (m ModerationModel) Report(report *Report) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var authorID int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id FROM reviews
+		WHERE id = $1 AND deleted_at IS NULL AND `+reviewVisible+`
+		FOR NO KEY UPDATE`, report.ReviewID).Scan(&authorID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if authorID == report.UserID {
+		return ErrOwnReview
+	}
+
+	query := `
+		INSERT INTO review_reports (review_id, user_id, reason, details)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (review_id, user_id) WHERE resolved_at IS NULL DO UPDATE
+		SET reason = EXCLUDED.reason, details = EXCLUDED.details
+		RETURNING id, created_at`
+
+	args := []any{report.ReviewID, report.UserID, report.Reason, report.Details}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&report.ID, &report.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE reviews
+		SET moderation_status = 'pending'
+		WHERE id = $1 AND moderation_status = 'visible'
+		AND (SELECT COUNT(*) FROM review_reports WHERE review_id = $1 AND resolved_at IS NULL) >= $2`,
+		report.ReviewID, ReportThreshold)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetQueue lists the reviews that need a moderator: those that are pending,
+// held or have open reports, most reported first. status narrows the queue to
+// reviews in one moderation status.
+func (m ModerationModel) GetQueue(status string, filters Filters) ([]*QueueItem, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + reviewColumns + `,
+			reports.open_reports, reports.reasons, reports.first_reported_at
+		FROM reviews
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS open_reports,
+				COALESCE(array_agg(DISTINCT reason) FILTER (WHERE reason IS NOT NULL), '{}') AS reasons,
+				MIN(created_at) AS first_reported_at
+			FROM review_reports
+			WHERE review_reports.review_id = reviews.id AND resolved_at IS NULL
+		) AS reports
+		WHERE reviews.deleted_at IS NULL
+		AND (reviews.moderation_status IN ('pending', 'held') OR reports.open_reports > 0)
+		AND (reviews.moderation_status = $1 OR $1 = '')
+		ORDER BY reports.open_reports DESC, reports.first_reported_at ASC NULLS LAST, reviews.id ASC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*QueueItem{}
+
+	for rows.Next() {
+		item := QueueItem{Review: &Review{}}
+		dest := append([]any{&totalRecords}, item.Review.fields()...)
+		dest = append(dest, &item.OpenReports, pq.Array(&item.Reasons), &item.FirstReportedAt)
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return items, metadata, nil
+}
+
+// GetReview returns any review that is not in the trash, whatever its
+// moderation status.
+func (m ModerationModel) GetReview(reviewID int64) (*Review, error) {
+	query := `
+		SELECT ` + reviewColumns + `
+		FROM reviews
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, reviewID).Scan(review.fields()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+// GetReports returns every report filed against a review, newest first.
+func (m ModerationModel) GetReports(reviewID int64) ([]*Report, error) {
+	query := `
+		SELECT id, review_id, user_id, reason, details, created_at, resolved_at IS NOT NULL
+		FROM review_reports
+		WHERE review_id = $1
+		ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*Report{}
+	for rows.Next() {
+		var report Report
+		err := rows.Scan(&report.ID, &report.ReviewID, &report.UserID, &report.Reason, &report.Details, &report.CreatedAt, &report.Resolved)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, &report)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// GetActions returns the moderation history of a review, oldest first.
+func (m ModerationModel) GetActions(reviewID int64) ([]*ModerationAction, error) {
+	query := `
+		SELECT review_moderation_actions.id, review_moderation_actions.moderator_id, users.username,
+			review_moderation_actions.action, review_moderation_actions.from_status,
+			review_moderation_actions.to_status, review_moderation_actions.note,
+			review_moderation_actions.created_at
+		FROM review_moderation_actions
+		LEFT JOIN users ON users.id = review_moderation_actions.moderator_id
+		WHERE review_moderation_actions.review_id = $1
+		ORDER BY review_moderation_actions.id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []*ModerationAction{}
+	for rows.Next() {
+		var action ModerationAction
+		err := rows.Scan(&action.ID, &action.ModeratorID, &action.Moderator, &action.Action,
+			&action.FromStatus, &action.ToStatus, &action.Note, &action.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, &action)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// Moderate applies a moderator's action to a review. It records the action
+// with the moderator's note, resolves the review's open reports and updates
+// the book's ratings, all in one transaction.
+func (m ModerationModel) Moderate(reviewID, moderatorID int64, action, note string) (*ModerationAction, error) {
+	toStatus, ok := moderationOutcomes[action]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var fromStatus string
+	var bookID int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT moderation_status, book_id FROM reviews
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR NO KEY UPDATE`, reviewID).Scan(&fromStatus, &bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE reviews SET moderation_status = $1 WHERE id = $2`, toStatus, reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE review_reports SET resolved_at = NOW()
+		WHERE review_id = $1 AND resolved_at IS NULL`, reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &ModerationAction{
+		ModeratorID: &moderatorID,
+		Action:      action,
+		FromStatus:  fromStatus,
+		ToStatus:    toStatus,
+		Note:        note,
+	}
+
+	query := `
+		INSERT INTO review_moderation_actions (review_id, moderator_id, action, from_status, to_status, note)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	args := []any{reviewID, moderatorID, action, fromStatus, toStatus, note}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&record.ID, &record.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = refreshBookRatings(ctx, tx, bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, tx.Commit()
+}
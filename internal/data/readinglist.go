@@ -5,7 +5,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/tchenbz/test3AWT/internal/validator"
 )
 
 type ReadingList struct {
@@ -19,6 +22,39 @@ type ReadingList struct {
 	Version     int32     `json:"version"`
 }
 
+var ReadingListStatuses = []string{"currently reading", "completed"}
+
+func ValidateReadingList(v *validator.Validator, list *ReadingList) {
+	v.Check(strings.TrimSpace(list.Name) != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(list.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+	v.Check(validator.PermittedValue(list.Status, ReadingListStatuses...), "status", "must be currently reading or completed")
+}
+
+// readingListBooksQuery selects the ids of the books on a list that are not
+// in the trash.
+const readingListBooksQuery = `
+	SELECT reading_list_books.book_id
+	FROM reading_list_books
+	INNER JOIN books ON books.id = reading_list_books.book_id
+	WHERE reading_list_books.reading_list_id = $1 AND books.deleted_at IS NULL`
+
+// readingListColumns lists the reading_lists columns in the order expected by ReadingList.fields.
+const readingListColumns = `reading_lists.id, reading_lists.name, reading_lists.description,
+		reading_lists.created_by, reading_lists.status, reading_lists.created_at, reading_lists.version`
+
+func (l *ReadingList) fields() []any {
+	return []any{
+		&l.ID,
+		&l.Name,
+		&l.Description,
+		&l.CreatedBy,
+		&l.Status,
+		&l.CreatedAt,
+		&l.Version,
+	}
+}
+
 type ReadingListModel struct {
 	DB *sql.DB
 }
@@ -43,19 +79,16 @@ func (m ReadingListModel) Get(id int64) (*ReadingList, error) {
 	}
 
 	query := `
-		SELECT id, name, description, created_by, status, created_at, version
+		SELECT ` + readingListColumns + `
 		FROM reading_lists
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	var list ReadingList
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&list.ID, &list.Name, &list.Description, &list.CreatedBy,
-		&list.Status, &list.CreatedAt, &list.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(list.fields()...)
 
 	if err != nil {
 		switch {
@@ -66,8 +99,7 @@ func (m ReadingListModel) Get(id int64) (*ReadingList, error) {
 		}
 	}
 
-	bookQuery := `SELECT book_id FROM reading_list_books WHERE reading_list_id = $1`
-	rows, err := m.DB.QueryContext(ctx, bookQuery, id)
+	rows, err := m.DB.QueryContext(ctx, readingListBooksQuery, id)
 	if err != nil {
 		return nil, err
 	}
@@ -89,10 +121,10 @@ func (m ReadingListModel) Update(list *ReadingList) error {
 	query := `
 		UPDATE reading_lists
 		SET name = $1, description = $2, status = $3, version = version + 1
-		WHERE id = $4
+		WHERE id = $4 AND version = $5 AND deleted_at IS NULL
 		RETURNING version`
 
-	args := []interface{}{list.Name, list.Description, list.Status, list.ID}
+	args := []interface{}{list.Name, list.Description, list.Status, list.ID, list.Version}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -101,7 +133,7 @@ func (m ReadingListModel) Update(list *ReadingList) error {
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrRecordNotFound
+			return ErrEditConflict
 		default:
 			return err
 		}
@@ -110,17 +142,20 @@ func (m ReadingListModel) Update(list *ReadingList) error {
 	return nil
 }
 
-func (m ReadingListModel) Delete(id int64) error {
+// Delete moves the list to the trash if it is still at the given version,
+// returning ErrEditConflict if it changed or was deleted since it was read.
+// Its books are kept so a restore brings the list back intact.
+func (m ReadingListModel) Delete(id int64, version int32) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `DELETE FROM reading_lists WHERE id = $1`
+	query := `UPDATE reading_lists SET deleted_at = NOW() WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -131,30 +166,67 @@ func (m ReadingListModel) Delete(id int64) error {
 	}
 
 	if rowsAffected == 0 {
-		return ErrRecordNotFound
+		return ErrEditConflict
 	}
 
-	deleteBooksQuery := `DELETE FROM reading_list_books WHERE reading_list_id = $1`
-	_, err = m.DB.ExecContext(ctx, deleteBooksQuery, id)
-	return err
+	return nil
 }
 
+// AddBook puts a book on a list unless another edition of the same work is
+// already there, in which case it returns ErrDuplicateWork. Adding a book
+// changes the list, so its version goes up.
 func (m ReadingListModel) AddBook(listID, bookID int64) error {
 	query := `
-		INSERT INTO reading_list_books (reading_list_id, book_id)
-		VALUES ($1, $2)`
+		WITH inserted AS (
+			INSERT INTO reading_list_books (reading_list_id, book_id)
+			SELECT $1, $2
+			WHERE NOT EXISTS (
+				SELECT 1
+				FROM reading_list_books
+				INNER JOIN books ON books.id = reading_list_books.book_id
+				INNER JOIN books added ON added.id = $2
+				WHERE reading_list_books.reading_list_id = $1
+				AND books.id <> added.id
+				AND books.work_id = added.work_id
+			)
+			RETURNING reading_list_id
+		)
+		UPDATE reading_lists
+		SET version = version + 1
+		WHERE id IN (SELECT reading_list_id FROM inserted)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, listID, bookID)
-	return err
+	result, err := m.DB.ExecContext(ctx, query, listID, bookID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrDuplicateWork
+	}
+
+	return nil
 }
 
+// RemoveBook takes a book off a list, raising the list's version if the book
+// was on it.
 func (m ReadingListModel) RemoveBook(listID, bookID int64) error {
 	query := `
-		DELETE FROM reading_list_books
-		WHERE reading_list_id = $1 AND book_id = $2`
+		WITH removed AS (
+			DELETE FROM reading_list_books
+			WHERE reading_list_id = $1 AND book_id = $2
+			RETURNING reading_list_id
+		)
+		UPDATE reading_lists
+		SET version = version + 1
+		WHERE id IN (SELECT reading_list_id FROM removed)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -164,49 +236,19 @@ func (m ReadingListModel) RemoveBook(listID, bookID int64) error {
 }
 
 func (m ReadingListModel) GetAll(name string, filters Filters) ([]*ReadingList, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, name, description, created_by, status, created_at, version
-		FROM reading_lists
-		WHERE (name ILIKE $1 OR $1 = '')
-		ORDER BY %s %s, id ASC
-		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
-
-	args := []interface{}{
-		"%" + name + "%",
-		filters.limit(),
-		filters.offset(),
-	}
+	where := `
+		WHERE (name ILIKE $1 OR $1 = '')`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	lists, metadata, err := m.list(where, []any{"%" + name + "%"}, filters)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
-	defer rows.Close()
 
-	totalRecords := 0
-	lists := []*ReadingList{}
-
-	for rows.Next() {
-		var list ReadingList
-		err := rows.Scan(
-			&totalRecords,
-			&list.ID,
-			&list.Name,
-			&list.Description,
-			&list.CreatedBy,
-			&list.Status,
-			&list.CreatedAt,
-			&list.Version,
-		)
-		if err != nil {
-			return nil, Metadata{}, err
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
-		bookQuery := `SELECT book_id FROM reading_list_books WHERE reading_list_id = $1`
-		bookRows, err := m.DB.QueryContext(ctx, bookQuery, list.ID)
+	for _, list := range lists {
+		bookRows, err := m.DB.QueryContext(ctx, readingListBooksQuery, list.ID)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -215,38 +257,42 @@ func (m ReadingListModel) GetAll(name string, filters Filters) ([]*ReadingList,
 			var bookID int64
 			err = bookRows.Scan(&bookID)
 			if err != nil {
+				bookRows.Close()
 				return nil, Metadata{}, err
 			}
 			list.Books = append(list.Books, bookID)
 		}
 		bookRows.Close()
-
-		lists = append(lists, &list)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
 	return lists, metadata, nil
 }
 
 func (m ReadingListModel) GetAllByUser(userID int64, name string, filters Filters) ([]*ReadingList, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, name, description, created_by, status, created_at, version
-		FROM reading_lists
+	where := `
 		WHERE created_by = $1
-		AND (name ILIKE $2 OR $2 = '')
+		AND (name ILIKE $2 OR $2 = '')`
+
+	return m.list(where, []any{userID, "%" + name + "%"}, filters)
+}
+
+// list runs a paginated reading list query restricted by where, whose
+// placeholders are numbered from $1 and bound by args. Lists in the trash are
+// always left out.
+func (m ReadingListModel) list(where string, args []any, filters Filters) ([]*ReadingList, Metadata, error) {
+	where += `
+		AND reading_lists.deleted_at IS NULL`
+	keyset, keysetArgs := filters.keysetCondition(len(args) + 1)
+	args = append(args, keysetArgs...)
+
+	query := fmt.Sprintf(`
+		SELECT %s, ` + readingListColumns + `, %s::text AS sort_value
+		FROM reading_lists %s %s
 		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		LIMIT $%d OFFSET $%d`, filters.countColumn(), filters.sortColumn(), where, keyset,
+		filters.sortColumn(), filters.sortDirection(), len(args)+1, len(args)+2)
 
-	args := []interface{}{
-		userID,              
-		"%" + name + "%",    
-		filters.limit(),    
-		filters.offset(),    
-	}
+	args = append(args, filters.limit(), filters.offset())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -259,29 +305,29 @@ func (m ReadingListModel) GetAllByUser(userID int64, name string, filters Filter
 
 	totalRecords := 0
 	lists := []*ReadingList{}
+	values := []string{}
 
 	for rows.Next() {
 		var list ReadingList
-		err := rows.Scan(
-			&totalRecords,
-			&list.ID,
-			&list.Name,
-			&list.Description,
-			&list.CreatedBy,
-			&list.Status,
-			&list.CreatedAt,
-			&list.Version,
-		)
+		var value string
+		dest := append([]any{&totalRecords}, list.fields()...)
+		err := rows.Scan(append(dest, &value)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 		lists = append(lists, &list)
+		values = append(values, value)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
 
+	if filters.Keyset {
+		lists, metadata := keysetPage(lists, values, filters, func(l *ReadingList) int64 { return l.ID })
+		return lists, metadata, nil
+	}
+
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
 	return lists, metadata, nil
 }
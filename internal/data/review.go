@@ -5,57 +5,163 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/tchenbz/test3AWT/internal/markdown"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+var (
+	ErrDuplicateReview = errors.New("duplicate review")
+	ErrReviewRemoved   = errors.New("review removed by a moderator")
 )
 
 type Review struct {
-	ID           int64     `json:"id"`
-	BookID       int64     `json:"book_id"`
-	Content      string    `json:"content"`
-	Author       string    `json:"author"`
-	Rating       int       `json:"rating"`         
-	HelpfulCount int       `json:"helpful_count"`  
-	CreatedAt    time.Time `json:"created_at"`
-	Version      int32     `json:"version"`
+	ID               int64      `json:"id"`
+	BookID           int64      `json:"book_id"`
+	UserID           int64      `json:"user_id"`
+	Content          string     `json:"content"`      // Markdown source
+	ContentHTML      string     `json:"content_html"` // Content rendered to sanitized HTML
+	Author           string     `json:"author"`       // the reviewer's current username, for display only
+	Rating           int        `json:"rating"`
+	HelpfulCount     int        `json:"helpful_count"` // net of up and down votes
+	ModerationStatus string     `json:"moderation_status"`
+	ContainsSpoilers bool       `json:"contains_spoilers"` // the whole review is a spoiler
+	SpoilersRedacted bool       `json:"spoilers_redacted,omitempty"`
+	EditedAt         *time.Time `json:"edited_at"`      // null until the review is first edited
+	RevisionCount    int        `json:"revision_count"` // number of edits, including pruned ones
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	Version          int32      `json:"version"`
+
+	// Held asks for the review to be taken down and put in the moderation
+	// queue when it is saved, because the content filter flagged it.
+	Held bool `json:"-"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(strings.TrimSpace(review.Content) != "", "content", "must be provided")
+	v.Check(len(review.Content) <= 10000, "content", "must not be more than 10000 bytes long")
+	v.Check(review.Rating >= 1 && review.Rating <= 5, "rating", "must be between 1 and 5")
+	ValidateSpoilerMarkup(v, "content", review.Content)
+}
+
+// reviewAuthor looks up the reviewer's username. It is a subquery rather than
+// a join so review listings can keep sorting on unqualified columns.
+const reviewAuthor = `(SELECT users.username FROM users WHERE users.id = reviews.user_id)`
+
+// reviewColumns lists the reviews columns in the order expected by Review.fields.
+const reviewColumns = `reviews.id, reviews.book_id, reviews.user_id, reviews.content, ` + reviewAuthor + `, reviews.rating,
+		reviews.helpful_count, reviews.created_at, reviews.version, reviews.updated_at, reviews.moderation_status,
+		reviews.contains_spoilers, reviews.content_html, reviews.edited_at, reviews.revision_count`
+
+func (r *Review) fields() []any {
+	return []any{
+		&r.ID,
+		&r.BookID,
+		&r.UserID,
+		&r.Content,
+		&r.Author,
+		&r.Rating,
+		&r.HelpfulCount,
+		&r.CreatedAt,
+		&r.Version,
+		&r.UpdatedAt,
+		&r.ModerationStatus,
+		&r.ContainsSpoilers,
+		&r.ContentHTML,
+		&r.EditedAt,
+		&r.RevisionCount,
+	}
+}
+
+// Visible reports whether the review is shown to everyone. Reviews reported
+// by readers stay up until a moderator hides or removes them; reviews held
+// by the content filter do not.
+func (r *Review) Visible() bool {
+	return r.ModerationStatus == ModerationVisible || r.ModerationStatus == ModerationPending
 }
 
 type ReviewModel struct {
 	DB *sql.DB
 }
 
-func (m ReviewModel) Insert(review *Review) error {
-	query := `
-		INSERT INTO reviews (book_id, content, author, rating, helpful_count)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at, version`
+// Upsert saves the user's review of a book, replacing the content and rating
+// of any review they already have for it, and updates the book's rating
+// summary in the same transaction. It reports whether a new review was
+// created. A held review that is visible or pending becomes held, which takes
+// it down until a moderator restores it. A review removed by a moderator is
+// kept as it is and ErrReviewRemoved is returned.
+func (m ReviewModel) Upsert(review *Review) (bool, error) {
+	review.ContentHTML = markdown.Render(review.Content)
 
-	args := []interface{}{review.BookID, review.Content, review.Author, review.Rating, review.HelpfulCount}
+	query := `
+		INSERT INTO reviews (book_id, user_id, content, rating, contains_spoilers, moderation_status,
+			content_html, content_html_version)
+		VALUES ($1, $2, $3, $4, $6, CASE WHEN $5 THEN 'held' ELSE 'visible' END, $7, $8)
+		ON CONFLICT (book_id, user_id) WHERE deleted_at IS NULL DO UPDATE
+		SET content = EXCLUDED.content, rating = EXCLUDED.rating,
+			contains_spoilers = EXCLUDED.contains_spoilers, version = reviews.version + 1,
+			content_html = EXCLUDED.content_html, content_html_version = EXCLUDED.content_html_version,
+			moderation_status = CASE WHEN $5 AND reviews.moderation_status IN ('visible', 'pending')
+				THEN 'held' ELSE reviews.moderation_status END
+		WHERE reviews.moderation_status <> 'removed'
+		RETURNING id, helpful_count, created_at, version, updated_at, moderation_status,
+			edited_at, revision_count, (xmax = 0)`
+
+	args := []interface{}{review.BookID, review.UserID, review.Content, review.Rating, review.Held, review.ContainsSpoilers,
+		review.ContentHTML, markdown.Version}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var created bool
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.HelpfulCount, &review.CreatedAt, &review.Version, &review.UpdatedAt, &review.ModerationStatus,
+		&review.EditedAt, &review.RevisionCount, &created)
+	if err != nil {
+		// No row comes back when the conflicting review was removed and the
+		// update was skipped
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrReviewRemoved
+		default:
+			return false, err
+		}
+	}
+
+	err = refreshBookRatings(ctx, tx, review.BookID)
+	if err != nil {
+		return false, err
+	}
+
+	return created, tx.Commit()
 }
 
+// Get returns a review that has not been deleted or removed by a moderator.
+// Hidden reviews are returned; callers decide who may see them.
 func (m ReviewModel) Get(reviewID int64) (*Review, error) {
 	if reviewID < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-		SELECT id, book_id, content, author, rating, helpful_count, created_at, version
+		SELECT ` + reviewColumns + `
 		FROM reviews
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL AND moderation_status <> 'removed'`
 
 	var review Review
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, reviewID).Scan(
-		&review.ID, &review.BookID, &review.Content, &review.Author,
-		&review.Rating, &review.HelpfulCount, &review.CreatedAt, &review.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, reviewID).Scan(review.fields()...)
 
 	if err != nil {
 		switch {
@@ -69,195 +175,248 @@ func (m ReviewModel) Get(reviewID int64) (*Review, error) {
 	return &review, nil
 }
 
+// Update saves the review's content and rating. A held review that is
+// visible or pending becomes held.
 func (m ReviewModel) Update(review *Review) error {
+	review.ContentHTML = markdown.Render(review.Content)
+
 	query := `
 		UPDATE reviews
-		SET content = $1, author = $2, rating = $3, helpful_count = $4, version = version + 1
-		WHERE id = $5
-		RETURNING version`
+		SET content = $1, rating = $2, contains_spoilers = $6, version = version + 1,
+			content_html = $7, content_html_version = $8,
+			moderation_status = CASE WHEN $5 AND moderation_status IN ('visible', 'pending')
+				THEN 'held' ELSE moderation_status END
+		WHERE id = $3 AND version = $4 AND deleted_at IS NULL AND moderation_status <> 'removed'
+		RETURNING version, updated_at, moderation_status, edited_at, revision_count`
 
-	args := []interface{}{review.Content, review.Author, review.Rating, review.HelpfulCount, review.ID}
+	args := []interface{}{review.Content, review.Rating, review.ID, review.Version, review.Held, review.ContainsSpoilers,
+		review.ContentHTML, markdown.Version}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.Version, &review.UpdatedAt, &review.ModerationStatus,
+		&review.EditedAt, &review.RevisionCount)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrRecordNotFound
+			return ErrEditConflict
 		default:
 			return err
 		}
 	}
 
-	return nil
+	err = refreshBookRatings(ctx, tx, review.BookID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m ReviewModel) Delete(reviewID int64) error {
+// Delete removes the review if it is still at the given version and
+// refreshes its book's ratings.
+func (m ReviewModel) Delete(reviewID int64, version int32) error {
 	if reviewID < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
-		DELETE FROM reviews
-		WHERE id = $1`
+		UPDATE reviews
+		SET deleted_at = NOW()
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		RETURNING book_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, reviewID)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	var bookID int64
+	err = tx.QueryRowContext(ctx, query, reviewID, version).Scan(&bookID)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	err = refreshBookRatings(ctx, tx, bookID)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (m ReviewModel) GetAll(content, author string, rating int, filters Filters) ([]*Review, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, book_id, content, author, rating, helpful_count, created_at, version
+// RenderStale renders the Markdown of up to limit reviews whose stored HTML
+// is missing or came from an older renderer, and returns how many it
+// rendered. Reviews being written at the same time are skipped; their writer
+// renders them.
+func (m ReviewModel) RenderStale(limit int) (int, error) {
+	query := `
+		SELECT id, content
 		FROM reviews
-		WHERE (content ILIKE $1 OR $1 = '')
-		AND (author ILIKE $2 OR $2 = '')
-		AND (rating = $3 OR $3 = 0)
-		ORDER BY %s %s, id ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
-
-	args := []interface{}{
-		"%" + content + "%",
-		"%" + author + "%",
-		rating,
-		filters.limit(),
-		filters.offset(),
-	}
+		WHERE content_html_version < $1
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, Metadata{}, err
+		return 0, err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	totalRecords := 0
-	reviews := []*Review{}
+	rows, err := tx.QueryContext(ctx, query, markdown.Version, limit)
+	if err != nil {
+		return 0, err
+	}
 
+	type stale struct {
+		id      int64
+		content string
+	}
+	var reviews []stale
 	for rows.Next() {
-		var review Review
-		err := rows.Scan(
-			&totalRecords,
-			&review.ID,
-			&review.BookID,
-			&review.Content,
-			&review.Author,
-			&review.Rating,
-			&review.HelpfulCount,
-			&review.CreatedAt,
-			&review.Version,
-		)
+		var r stale
+		err := rows.Scan(&r.id, &r.content)
 		if err != nil {
-			return nil, Metadata{}, err
+			rows.Close()
+			return 0, err
 		}
-		reviews = append(reviews, &review)
+		reviews = append(reviews, r)
 	}
-
+	rows.Close()
 	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+		return 0, err
 	}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
-	return reviews, metadata, nil
-}
-
-func (m ReviewModel) GetAllForBook(bookID int64, content, author string, rating int, filters Filters) ([]*Review, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, book_id, content, author, rating, helpful_count, created_at, version
-		FROM reviews
-		WHERE book_id = $1
-		AND (content ILIKE $2 OR $2 = '')
-		AND (author ILIKE $3 OR $3 = '')
-		AND (rating = $4 OR $4 = 0)
-		ORDER BY %s %s, id ASC
-		LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
-
-	args := []interface{}{
-		bookID,
-		"%" + content + "%",
-		"%" + author + "%",
-		rating,
-		filters.limit(),
-		filters.offset(),
+	for _, r := range reviews {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE reviews
+			SET content_html = $1, content_html_version = $2
+			WHERE id = $3`, markdown.Render(r.content), markdown.Version, r.id)
+		if err != nil {
+			return 0, err
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	return len(reviews), tx.Commit()
+}
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+// refreshBookRatings recomputes a book's rating summary from its visible
+// reviews, leaving out those in the trash or taken down by a moderator. The
+// book row is locked first, so concurrent changes to the same book's reviews
+// are summarised one after another, each seeing the ratings the others
+// committed.
+func refreshBookRatings(ctx context.Context, tx *sql.Tx, bookID int64) error {
+	_, err := tx.ExecContext(ctx, `SELECT id FROM books WHERE id = $1 FOR NO KEY UPDATE`, bookID)
 	if err != nil {
-		return nil, Metadata{}, err
+		return err
 	}
-	defer rows.Close()
 
-	totalRecords := 0
-	reviews := []*Review{}
+	query := `
+		UPDATE books
+		SET ratings_count = stats.count, average_rating = stats.average, rating_histogram = stats.histogram
+		FROM (
+			SELECT COUNT(*) AS count,
+				COALESCE(AVG(rating), 0) AS average,
+				ARRAY[
+					COUNT(*) FILTER (WHERE rating = 1),
+					COUNT(*) FILTER (WHERE rating = 2),
+					COUNT(*) FILTER (WHERE rating = 3),
+					COUNT(*) FILTER (WHERE rating = 4),
+					COUNT(*) FILTER (WHERE rating = 5)
+				]::integer[] AS histogram
+			FROM reviews
+			WHERE book_id = $1 AND deleted_at IS NULL AND ` + reviewVisible + `
+		) AS stats
+		WHERE books.id = $1`
+
+	_, err = tx.ExecContext(ctx, query, bookID)
+	return err
+}
 
-	for rows.Next() {
-		var review Review
-		err := rows.Scan(
-			&totalRecords,
-			&review.ID,
-			&review.BookID,
-			&review.Content,
-			&review.Author,
-			&review.Rating,
-			&review.HelpfulCount,
-			&review.CreatedAt,
-			&review.Version,
-		)
-		if err != nil {
-			return nil, Metadata{}, err
-		}
-		reviews = append(reviews, &review)
-	}
+func (m ReviewModel) GetAll(content, author string, rating int, filters Filters) ([]*Review, Metadata, error) {
+	where := `
+		WHERE (content ILIKE $1 OR $1 = '')
+		AND (` + reviewAuthor + ` ILIKE $2 OR $2 = '')
+		AND (rating = $3 OR $3 = 0)`
 
-	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
-	}
+	args := []any{"%" + content + "%", "%" + author + "%", rating}
+	return m.list(where, args, filters)
+}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
-	return reviews, metadata, nil
+func (m ReviewModel) GetAllForBook(bookID int64, content, author string, rating int, filters Filters) ([]*Review, Metadata, error) {
+	where := `
+		WHERE book_id = $1
+		AND (content ILIKE $2 OR $2 = '')
+		AND (` + reviewAuthor + ` ILIKE $3 OR $3 = '')
+		AND (rating = $4 OR $4 = 0)`
+
+	args := []any{bookID, "%" + content + "%", "%" + author + "%", rating}
+	return m.list(where, args, filters)
+}
+
+// GetAllForWork lists the reviews of every edition of a work.
+func (m ReviewModel) GetAllForWork(workID int64, content, author string, rating int, filters Filters) ([]*Review, Metadata, error) {
+	where := `
+		WHERE book_id IN (SELECT id FROM books WHERE work_id = $1)
+		AND (content ILIKE $2 OR $2 = '')
+		AND (` + reviewAuthor + ` ILIKE $3 OR $3 = '')
+		AND (rating = $4 OR $4 = 0)`
+
+	args := []any{workID, "%" + content + "%", "%" + author + "%", rating}
+	return m.list(where, args, filters)
 }
 
 func (m ReviewModel) GetAllByUser(userID int64, content, author string, rating int, filters Filters) ([]*Review, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, book_id, content, author, rating, helpful_count, created_at, version
-		FROM reviews
+	where := `
 		WHERE user_id = $1
 		AND (content ILIKE $2 OR $2 = '')
-		AND (author ILIKE $3 OR $3 = '')
-		AND (rating = $4 OR $4 = 0)
+		AND (` + reviewAuthor + ` ILIKE $3 OR $3 = '')
+		AND (rating = $4 OR $4 = 0)`
+
+	args := []any{userID, "%" + content + "%", "%" + author + "%", rating}
+	return m.list(where, args, filters)
+}
+
+// list runs a paginated review query restricted by where, whose placeholders
+// are numbered from $1 and bound by args. Reviews in the trash, reviews of
+// books in the trash and reviews taken down by a moderator are always left
+// out.
+func (m ReviewModel) list(where string, args []any, filters Filters) ([]*Review, Metadata, error) {
+	where += `
+		AND reviews.deleted_at IS NULL
+		AND ` + reviewVisible + `
+		AND EXISTS (SELECT 1 FROM books WHERE books.id = reviews.book_id AND books.deleted_at IS NULL)`
+	keyset, keysetArgs := filters.keysetCondition(len(args) + 1)
+	args = append(args, keysetArgs...)
+
+	query := fmt.Sprintf(`
+		SELECT %s, ` + reviewColumns + `, %s::text AS sort_value
+		FROM reviews %s %s
 		ORDER BY %s %s, id ASC
-		LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
-
-	args := []interface{}{
-		userID,
-		"%" + content + "%",
-		"%" + author + "%",
-		rating,
-		filters.limit(),
-		filters.offset(),
-	}
+		LIMIT $%d OFFSET $%d`, filters.countColumn(), filters.sortColumn(), where, keyset,
+		filters.sortColumn(), filters.sortDirection(), len(args)+1, len(args)+2)
+
+	args = append(args, filters.limit(), filters.offset())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -270,30 +429,29 @@ func (m ReviewModel) GetAllByUser(userID int64, content, author string, rating i
 
 	totalRecords := 0
 	reviews := []*Review{}
+	values := []string{}
 
 	for rows.Next() {
 		var review Review
-		err := rows.Scan(
-			&totalRecords,
-			&review.ID,
-			&review.BookID,
-			&review.Content,
-			&review.Author,
-			&review.Rating,
-			&review.HelpfulCount,
-			&review.CreatedAt,
-			&review.Version,
-		)
+		var value string
+		dest := append([]any{&totalRecords}, review.fields()...)
+		err := rows.Scan(append(dest, &value)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 		reviews = append(reviews, &review)
+		values = append(values, value)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
 
+	if filters.Keyset {
+		reviews, metadata := keysetPage(reviews, values, filters, func(r *Review) int64 { return r.ID })
+		return reviews, metadata, nil
+	}
+
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
 	return reviews, metadata, nil
 }
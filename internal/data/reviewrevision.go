@@ -0,0 +1,78 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/tchenbz/test3AWT/internal/markdown"
+)
+
+// ReviewRevision is a state a review had before an edit replaced it. The
+// revisions are recorded by a trigger on reviews whenever the content, rating
+// or spoiler flag changes.
+type ReviewRevision struct {
+	Version          int32     `json:"version"`
+	Content          string    `json:"content"`
+	ContentHTML      string    `json:"content_html"`
+	Rating           int       `json:"rating"`
+	ContainsSpoilers bool      `json:"contains_spoilers"`
+	WrittenAt        time.Time `json:"written_at"`
+	ReplacedAt       time.Time `json:"replaced_at"`
+}
+
+// GetRevisions returns the retained earlier states of a review, newest
+// first. Older revisions may have been pruned, so there can be fewer than
+// the review's revision count. Each revision has the HTML stored with it,
+// unless that came from an older renderer and is rendered again here.
+func (m ReviewModel) GetRevisions(reviewID int64) ([]*ReviewRevision, error) {
+	query := `
+		SELECT version, content, content_html, content_html_version, COALESCE(rating, 0), contains_spoilers,
+			written_at, replaced_at
+		FROM review_revisions
+		WHERE review_id = $1
+		ORDER BY version DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*ReviewRevision{}
+	for rows.Next() {
+		var revision ReviewRevision
+		var htmlVersion int
+		err := rows.Scan(&revision.Version, &revision.Content, &revision.ContentHTML, &htmlVersion, &revision.Rating,
+			&revision.ContainsSpoilers, &revision.WrittenAt, &revision.ReplacedAt)
+		if err != nil {
+			return nil, err
+		}
+		if htmlVersion < markdown.Version {
+			revision.ContentHTML = markdown.Render(revision.Content)
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// PruneRevisions deletes review revisions replaced longer ago than retention
+// and returns how many it deleted. Reviews keep their revision count.
+func (m ReviewModel) PruneRevisions(retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM review_revisions WHERE replaced_at < $1`, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
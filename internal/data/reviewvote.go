@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+var ErrOwnReview = errors.New("own review")
+
+// Votes are up or down; a review's helpful_count is the net of its votes.
+const (
+	VoteUp   = 1
+	VoteDown = -1
+)
+
+func ValidateVote(v *validator.Validator, value int) {
+	v.Check(value == VoteUp || value == VoteDown, "value", "must be 1 or -1")
+}
+
+// Vote records the user's vote on a review, replacing any earlier vote, and
+// returns the review's new helpful count. Reviewers cannot vote on their own
+// reviews.
+func (m ReviewModel) Vote(reviewID, userID int64, value int) (int, error) {
+	query := `
+		INSERT INTO review_votes (review_id, user_id, value)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (review_id, user_id) DO UPDATE
+		SET value = EXCLUDED.value, created_at = NOW()`
+
+	return m.changeVote(reviewID, userID, query, reviewID, userID, value)
+}
+
+// Unvote withdraws the user's vote on a review, if they had one, and returns
+// the review's new helpful count.
+func (m ReviewModel) Unvote(reviewID, userID int64) (int, error) {
+	query := `
+		DELETE FROM review_votes
+		WHERE review_id = $1 AND user_id = $2`
+
+	return m.changeVote(reviewID, userID, query, reviewID, userID)
+}
+
+// changeVote runs query against review_votes and recounts the review's
+// votes. The review row is locked first, so concurrent votes on the same
+// review are counted one after another.
+func (m ReviewModel) changeVote(reviewID, userID int64, query string, args ...any) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var authorID int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id FROM reviews
+		WHERE id = $1 AND deleted_at IS NULL AND `+reviewVisible+`
+		FOR NO KEY UPDATE`, reviewID).Scan(&authorID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	if authorID == userID {
+		return 0, ErrOwnReview
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	var helpfulCount int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE reviews
+		SET helpful_count = (SELECT COALESCE(SUM(value), 0) FROM review_votes WHERE review_id = $1)
+		WHERE id = $1
+		RETURNING helpful_count`, reviewID).Scan(&helpfulCount)
+	if err != nil {
+		return 0, err
+	}
+
+	return helpfulCount, tx.Commit()
+}
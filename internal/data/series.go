@@ -0,0 +1,366 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+var ErrNotInSeries = errors.New("book is not part of a series")
+
+type Series struct {
+	ID          int64     `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	Version     int32     `json:"version"`
+}
+
+// SeriesEntry is a book at its position in a series.
+type SeriesEntry struct {
+	Position float64 `json:"position"`
+	Book     *Book   `json:"book"`
+}
+
+// BookSeries is the series block shown on a book.
+type BookSeries struct {
+	ID       int64   `json:"id"`
+	Title    string  `json:"title"`
+	Position float64 `json:"position"`
+}
+
+func ValidateSeries(v *validator.Validator, series *Series) {
+	v.Check(strings.TrimSpace(series.Title) != "", "title", "must be provided")
+	v.Check(len(series.Title) <= 500, "title", "must not be more than 500 bytes long")
+}
+
+func ValidateSeriesPosition(v *validator.Validator, position float64) {
+	v.Check(position > 0, "position", "must be greater than zero")
+	v.Check(position < 1000000, "position", "must be less than 1000000")
+	// Positions such as 1.1 are not exact in binary, so compare the scaled
+	// value with a small tolerance rather than for equality.
+	v.Check(math.Abs(math.Round(position*100)-position*100) < 1e-9, "position", "must have at most two decimal places")
+}
+
+type SeriesModel struct {
+	DB *sql.DB
+}
+
+func (m SeriesModel) Insert(series *Series) error {
+	query := `
+		INSERT INTO series (title, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, series.Title, series.Description).Scan(&series.ID, &series.CreatedAt, &series.Version)
+}
+
+func (m SeriesModel) Get(id int64) (*Series, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, title, description, created_at, version
+		FROM series
+		WHERE id = $1`
+
+	var series Series
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&series.ID, &series.Title, &series.Description, &series.CreatedAt, &series.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &series, nil
+}
+
+func (m SeriesModel) Update(series *Series) error {
+	query := `
+		UPDATE series
+		SET title = $1, description = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []any{series.Title, series.Description, series.ID, series.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&series.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m SeriesModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM series
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m SeriesModel) GetAll(title string, filters Filters) ([]*Series, Metadata, error) {
+	args := []any{"%" + title + "%"}
+	keyset, keysetArgs := filters.keysetCondition(len(args) + 1)
+	args = append(args, keysetArgs...)
+
+	query := fmt.Sprintf(`
+		SELECT %s, id, title, description, created_at, version, %s::text AS sort_value
+		FROM series
+		WHERE (title ILIKE $1 OR $1 = '') %s
+		ORDER BY %s %s, id ASC
+		LIMIT $%d OFFSET $%d`, filters.countColumn(), filters.sortColumn(), keyset,
+		filters.sortColumn(), filters.sortDirection(), len(args)+1, len(args)+2)
+
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	all := []*Series{}
+	values := []string{}
+
+	for rows.Next() {
+		var series Series
+		var value string
+		err := rows.Scan(&totalRecords, &series.ID, &series.Title, &series.Description, &series.CreatedAt, &series.Version, &value)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		all = append(all, &series)
+		values = append(values, value)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if filters.Keyset {
+		all, metadata := keysetPage(all, values, filters, func(s *Series) int64 { return s.ID })
+		return all, metadata, nil
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return all, metadata, nil
+}
+
+// GetBooks lists the entries of a series in reading order.
+func (m SeriesModel) GetBooks(seriesID int64) ([]*SeriesEntry, error) {
+	query := `
+		SELECT series_books.position, ` + bookColumns + `
+		FROM series_books
+		INNER JOIN books ON books.id = series_books.book_id
+		WHERE series_books.series_id = $1
+		AND books.deleted_at IS NULL
+		ORDER BY series_books.position ASC, books.id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*SeriesEntry{}
+
+	for rows.Next() {
+		entry := SeriesEntry{Book: &Book{}}
+		err := rows.Scan(append([]any{&entry.Position}, entry.Book.fields()...)...)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// AddBook places a book in the series at position. A book that already
+// belongs to a series is moved.
+func (m SeriesModel) AddBook(seriesID, bookID int64, position float64) error {
+	query := `
+		INSERT INTO series_books (series_id, book_id, position)
+		SELECT $1, id, $3
+		FROM books
+		WHERE id = $2 AND deleted_at IS NULL
+		ON CONFLICT (book_id) DO UPDATE
+		SET series_id = EXCLUDED.series_id, position = EXCLUDED.position`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, seriesID, bookID, position)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m SeriesModel) RemoveBook(seriesID, bookID int64) error {
+	query := `
+		DELETE FROM series_books
+		WHERE series_id = $1 AND book_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, seriesID, bookID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotInSeries
+	}
+
+	return nil
+}
+
+// NextUnread returns the first entry after bookID in its series that the
+// user has not read. A book counts as read when it, or another edition of
+// the same work, is on one of the user's completed reading lists. The entry
+// is nil when the user has read everything that follows.
+func (m SeriesModel) NextUnread(bookID, userID int64) (*BookSeries, *SeriesEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	series, err := loadBookSeries(ctx, m.DB, bookID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if series == nil {
+		return nil, nil, ErrNotInSeries
+	}
+
+	query := `
+		SELECT series_books.position, ` + bookColumns + `
+		FROM series_books
+		INNER JOIN books ON books.id = series_books.book_id
+		WHERE series_books.series_id = $1
+		AND series_books.position > $2
+		AND books.deleted_at IS NULL
+		AND NOT EXISTS (
+			SELECT 1
+			FROM reading_lists
+			INNER JOIN reading_list_books ON reading_list_books.reading_list_id = reading_lists.id
+			INNER JOIN books read_book ON read_book.id = reading_list_books.book_id
+			WHERE reading_lists.created_by = $3
+			AND reading_lists.deleted_at IS NULL
+			AND reading_lists.status = 'completed'
+			AND (read_book.id = books.id OR read_book.work_id = books.work_id)
+		)
+		ORDER BY series_books.position ASC, books.id ASC
+		LIMIT 1`
+
+	entry := SeriesEntry{Book: &Book{}}
+	err = m.DB.QueryRowContext(ctx, query, series.ID, series.Position, userID).Scan(append([]any{&entry.Position}, entry.Book.fields()...)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return series, nil, nil
+		default:
+			return nil, nil, err
+		}
+	}
+
+	return series, &entry, nil
+}
+
+// loadBookSeries returns the series block of a book, or nil when the book
+// is not part of a series.
+func loadBookSeries(ctx context.Context, q querier, bookID int64) (*BookSeries, error) {
+	query := `
+		SELECT series.id, series.title, series_books.position
+		FROM series_books
+		INNER JOIN series ON series.id = series_books.series_id
+		WHERE series_books.book_id = $1`
+
+	var series BookSeries
+
+	err := q.QueryRowContext(ctx, query, bookID).Scan(&series.ID, &series.Title, &series.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &series, nil
+}
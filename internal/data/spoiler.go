@@ -0,0 +1,50 @@
+package data
+
+import (
+	"regexp"
+
+	"github.com/tchenbz/test3AWT/internal/markdown"
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+// Spoiler settings, used both for the spoilers query parameter on review
+// listings and for a user's saved preference.
+const (
+	SpoilersHide = "hide"
+	SpoilersShow = "show"
+)
+
+var SpoilerSettings = []string{SpoilersHide, SpoilersShow}
+
+// SpoilerPlaceholder replaces spoiler text in redacted reviews.
+const SpoilerPlaceholder = "[spoiler hidden]"
+
+// Reviewers mark part of a review as a spoiler by wrapping it in
+// [spoiler]...[/spoiler]. Spoiler ranges do not nest.
+var (
+	spoilerRangeRX = regexp.MustCompile(`(?is)\[spoiler\].*?\[/spoiler\]`)
+	spoilerTagRX   = regexp.MustCompile(`(?i)\[/?spoiler\]`)
+)
+
+func ValidateSpoilerMarkup(v *validator.Validator, key, text string) {
+	unpaired := spoilerTagRX.MatchString(spoilerRangeRX.ReplaceAllString(text, ""))
+	v.Check(!unpaired, key, "must close every [spoiler] with [/spoiler] and not nest them")
+}
+
+// RedactSpoilers replaces the review's spoilers with SpoilerPlaceholder: the
+// whole content if the review is marked as containing spoilers, otherwise
+// each marked range. ContentHTML is rendered again from what is left.
+func (r *Review) RedactSpoilers() {
+	redacted := r.Content
+	if r.ContainsSpoilers {
+		redacted = SpoilerPlaceholder
+	} else {
+		redacted = spoilerRangeRX.ReplaceAllLiteralString(redacted, SpoilerPlaceholder)
+	}
+
+	if redacted != r.Content {
+		r.Content = redacted
+		r.ContentHTML = markdown.Render(redacted)
+		r.SpoilersRedacted = true
+	}
+}
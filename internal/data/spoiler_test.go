@@ -0,0 +1,67 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tchenbz/test3AWT/internal/markdown"
+)
+
+func TestRedactSpoilers(t *testing.T) {
+	tests := []struct {
+		name             string
+		content          string
+		containsSpoilers bool
+		wantContent      string
+		wantRedacted     bool
+	}{
+		{
+			name:        "no spoilers",
+			content:     "A *great* read.",
+			wantContent: "A *great* read.",
+		},
+		{
+			name:         "marked range",
+			content:      "It was [spoiler]the butler[/spoiler] all along.",
+			wantContent:  "It was " + SpoilerPlaceholder + " all along.",
+			wantRedacted: true,
+		},
+		{
+			name:         "several ranges",
+			content:      "[SPOILER]one[/spoiler] and [spoiler]two\nlines[/Spoiler]",
+			wantContent:  SpoilerPlaceholder + " and " + SpoilerPlaceholder,
+			wantRedacted: true,
+		},
+		{
+			name:             "whole review",
+			content:          "Everybody dies in the end.",
+			containsSpoilers: true,
+			wantContent:      SpoilerPlaceholder,
+			wantRedacted:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review := &Review{
+				Content:          tt.content,
+				ContentHTML:      markdown.Render(tt.content),
+				ContainsSpoilers: tt.containsSpoilers,
+			}
+			review.RedactSpoilers()
+
+			if review.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", review.Content, tt.wantContent)
+			}
+			if review.SpoilersRedacted != tt.wantRedacted {
+				t.Errorf("SpoilersRedacted = %t, want %t", review.SpoilersRedacted, tt.wantRedacted)
+			}
+			if want := markdown.Render(tt.wantContent); review.ContentHTML != want {
+				t.Errorf("ContentHTML = %q, want %q", review.ContentHTML, want)
+			}
+			if tt.wantRedacted && strings.Contains(review.ContentHTML, `class="spoiler"`) {
+				t.Errorf("ContentHTML still has a spoiler: %q", review.ContentHTML)
+			}
+		})
+	}
+}
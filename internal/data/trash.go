@@ -0,0 +1,189 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	TrashBooks        = "books"
+	TrashReviews      = "reviews"
+	TrashReadingLists = "reading_lists"
+)
+
+var TrashTypes = []string{TrashBooks, TrashReviews, TrashReadingLists}
+
+// TrashItem is a soft-deleted book, review or reading list.
+type TrashItem struct {
+	Type      string    `json:"type"`
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type TrashModel struct {
+	DB *sql.DB
+}
+
+// GetAll lists the trash, most recently deleted first. An empty kind lists
+// every type.
+func (m TrashModel) GetAll(kind string, filters Filters) ([]*TrashItem, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), type, id, title, deleted_at
+		FROM (
+			SELECT 'books' AS type, id, title, deleted_at
+			FROM books
+			WHERE deleted_at IS NOT NULL
+			UNION ALL
+			SELECT 'reviews', id, LEFT(content, 80), deleted_at
+			FROM reviews
+			WHERE deleted_at IS NOT NULL
+			UNION ALL
+			SELECT 'reading_lists', id, name, deleted_at
+			FROM reading_lists
+			WHERE deleted_at IS NOT NULL
+		) trash
+		WHERE (type = $1 OR $1 = '')
+		ORDER BY %s %s, type ASC, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, kind, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*TrashItem{}
+
+	for rows.Next() {
+		var item TrashItem
+		err := rows.Scan(&totalRecords, &item.Type, &item.ID, &item.Title, &item.DeletedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return items, metadata, nil
+}
+
+// Restore takes an item of the given type back out of the trash. A book
+// whose ISBN has been reused in the meantime cannot be restored and yields
+// ErrDuplicateISBN.
+func (m TrashModel) Restore(kind string, id int64) error {
+	var query string
+	switch kind {
+	case TrashBooks:
+		query = `UPDATE books SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
+	case TrashReviews:
+		query = `UPDATE reviews SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
+	case TrashReadingLists:
+		query = `UPDATE reading_lists SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
+	default:
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "books_isbn_key"`:
+			return ErrDuplicateISBN
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_book_id_user_id_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	// A restored review counts towards its book's ratings again.
+	if kind == TrashReviews {
+		var bookID int64
+		err = tx.QueryRowContext(ctx, `SELECT book_id FROM reviews WHERE id = $1`, id).Scan(&bookID)
+		if err != nil {
+			return err
+		}
+
+		err = refreshBookRatings(ctx, tx, bookID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Purge permanently deletes everything that has been in the trash for
+// longer than retention and reports how many rows went. Purging a book
+// cascades to its reviews and reading list entries.
+func (m TrashModel) Purge(retention time.Duration) (int64, error) {
+	if retention <= 0 {
+		return 0, errors.New("retention must be positive")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	cutoff := time.Now().Add(-retention)
+	queries := []string{
+		`DELETE FROM reviews WHERE deleted_at < $1`,
+		`DELETE FROM reading_lists WHERE deleted_at < $1`,
+		`DELETE FROM books WHERE deleted_at < $1`,
+	}
+
+	var purged int64
+	for _, query := range queries {
+		result, err := tx.ExecContext(ctx, query, cutoff)
+		if err != nil {
+			return 0, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		purged += rowsAffected
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
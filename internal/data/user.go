@@ -21,13 +21,13 @@ func (u UserModel) Insert(user *User) error {
 	query := `
 	INSERT INTO users (username, email, password_hash, activated) 
 	VALUES ($1, $2, $3, $4)
-	RETURNING id, created_at, version
+	RETURNING id, created_at, version, spoilers
    `
 args := []any{user.Username, user.Email, user.Password.hash, user.Activated}
 
 ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 defer cancel()
-err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version, &user.Preferences.Spoilers)
 if err != nil {
 	switch {
 		case err.Error() == `pq: duplicate key value violates unique 
@@ -50,9 +50,20 @@ type User struct {
     Email      string      `json:"email"`
 	Password   password   `json:"-"`
     Activated  bool       `json:"activated"`
+    Preferences Preferences `json:"preferences"`
     Version     int        `json:"-"`  
 }
 
+// Preferences are defaults the user has chosen for how the API presents
+// content to them.
+type Preferences struct {
+	Spoilers string `json:"spoilers"` // hide or show spoilers in review listings
+}
+
+func ValidatePreferences(v *validator.Validator, prefs Preferences) {
+	v.Check(validator.PermittedValue(prefs.Spoilers, SpoilerSettings...), "spoilers", "must be hide or show")
+}
+
 func (u *User) IsAnonymous() bool {
     return u == AnonymousUser
 }
@@ -90,7 +101,7 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 
 func (u UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-	SELECT id, created_at, username, email, password_hash, activated, version
+	SELECT id, created_at, username, email, password_hash, activated, spoilers, version
 	FROM users
 	WHERE email = $1
    `
@@ -105,6 +116,7 @@ err := u.DB.QueryRowContext(ctx, query, email).Scan(
 	&user.Email,
 	&user.Password.hash,
 	&user.Activated,
+	&user.Preferences.Spoilers,
 	&user.Version,
 )
 if err != nil {
@@ -182,7 +194,7 @@ func (u UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
     tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	query := `
 			SELECT users.id, users.created_at, users.username,
-				users.email, users.password_hash, users.activated, users.version
+				users.email, users.password_hash, users.activated, users.spoilers, users.version
 			FROM users
 			INNER JOIN tokens
 			ON users.id = tokens.user_id
@@ -201,6 +213,7 @@ func (u UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 			 &user.Email,
 			 &user.Password.hash,
 			 &user.Activated,
+			 &user.Preferences.Spoilers,
 			 &user.Version,
 		   )
 		   if err != nil {
@@ -216,7 +229,7 @@ func (u UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 
 func (u UserModel) GetByID(id int64) (*User, error) {
 	query := `
-		SELECT id, created_at, username, email, activated, version
+		SELECT id, created_at, username, email, activated, spoilers, version
 		FROM users
 		WHERE id = $1
 	`
@@ -232,6 +245,7 @@ func (u UserModel) GetByID(id int64) (*User, error) {
 		&user.Username,
 		&user.Email,
 		&user.Activated,
+		&user.Preferences.Spoilers,
 		&user.Version,
 	)
 	if err != nil {
@@ -245,3 +259,30 @@ func (u UserModel) GetByID(id int64) (*User, error) {
 
 	return &user, nil
 }
+
+// UpdatePreferences saves the user's preferences.
+func (u UserModel) UpdatePreferences(userID int64, prefs Preferences) error {
+	query := `
+		UPDATE users
+		SET spoilers = $1
+		WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := u.DB.ExecContext(ctx, query, prefs.Spoilers, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
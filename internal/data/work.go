@@ -0,0 +1,354 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tchenbz/test3AWT/internal/validator"
+)
+
+var (
+	ErrNotAnEdition  = errors.New("book is not an edition of this work")
+	ErrDuplicateWork = errors.New("another edition of this work is already present")
+)
+
+// Work groups the editions of one book (hardcover, paperback, translations,
+// audiobooks) so reviews and ratings can be aggregated across them.
+type Work struct {
+	ID                 int64     `json:"id"`
+	Title              string    `json:"title"`
+	Description        string    `json:"description"`
+	PreferredEditionID *int64    `json:"preferred_edition_id"`
+	EditionCount       int       `json:"edition_count"`
+	AverageRating      float32   `json:"average_rating"`
+	RatingsCount       int       `json:"ratings_count"`
+	CreatedAt          time.Time `json:"created_at"`
+	Version            int32     `json:"version"`
+}
+
+func ValidateWork(v *validator.Validator, work *Work) {
+	v.Check(strings.TrimSpace(work.Title) != "", "title", "must be provided")
+	v.Check(len(work.Title) <= 500, "title", "must not be more than 500 bytes long")
+}
+
+// workColumns selects a work together with its edition and review aggregates.
+const workColumns = `works.id, works.title, works.description, works.preferred_edition_id,
+		(SELECT COUNT(*) FROM books WHERE books.work_id = works.id AND books.deleted_at IS NULL),
+		(SELECT COALESCE(AVG(reviews.rating), 0) FROM reviews INNER JOIN books ON books.id = reviews.book_id
+			WHERE books.work_id = works.id AND books.deleted_at IS NULL AND reviews.deleted_at IS NULL
+			AND ` + reviewVisible + `),
+		(SELECT COUNT(*) FROM reviews INNER JOIN books ON books.id = reviews.book_id
+			WHERE books.work_id = works.id AND books.deleted_at IS NULL AND reviews.deleted_at IS NULL
+			AND ` + reviewVisible + `),
+		works.created_at, works.version`
+
+func (w *Work) fields() []any {
+	return []any{
+		&w.ID,
+		&w.Title,
+		&w.Description,
+		&w.PreferredEditionID,
+		&w.EditionCount,
+		&w.AverageRating,
+		&w.RatingsCount,
+		&w.CreatedAt,
+		&w.Version,
+	}
+}
+
+type WorkModel struct {
+	DB *sql.DB
+}
+
+func (m WorkModel) Insert(work *Work) error {
+	query := `
+		INSERT INTO works (title, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, work.Title, work.Description).Scan(&work.ID, &work.CreatedAt, &work.Version)
+}
+
+func (m WorkModel) Get(id int64) (*Work, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + workColumns + `
+		FROM works
+		WHERE works.id = $1`
+
+	var work Work
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(work.fields()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &work, nil
+}
+
+func (m WorkModel) Update(work *Work) error {
+	query := `
+		UPDATE works
+		SET title = $1, description = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []any{work.Title, work.Description, work.ID, work.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&work.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the work. Its editions stay in the catalog, detached.
+func (m WorkModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM works
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m WorkModel) GetAll(title string, filters Filters) ([]*Work, Metadata, error) {
+	args := []any{"%" + title + "%"}
+	keyset, keysetArgs := filters.keysetCondition(len(args) + 1)
+	args = append(args, keysetArgs...)
+
+	query := fmt.Sprintf(`
+		SELECT %s, `+workColumns+`, works.%s::text AS sort_value
+		FROM works
+		WHERE (works.title ILIKE $1 OR $1 = '') %s
+		ORDER BY %s %s, id ASC
+		LIMIT $%d OFFSET $%d`, filters.countColumn(), filters.sortColumn(), keyset,
+		filters.sortColumn(), filters.sortDirection(), len(args)+1, len(args)+2)
+
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	works := []*Work{}
+	values := []string{}
+
+	for rows.Next() {
+		var work Work
+		var value string
+		dest := append([]any{&totalRecords}, work.fields()...)
+		err := rows.Scan(append(dest, &value)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		works = append(works, &work)
+		values = append(values, value)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if filters.Keyset {
+		works, metadata := keysetPage(works, values, filters, func(w *Work) int64 { return w.ID })
+		return works, metadata, nil
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return works, metadata, nil
+}
+
+// GetEditions lists the books attached to a work, preferred edition first.
+func (m WorkModel) GetEditions(workID int64) ([]*Book, error) {
+	query := `
+		SELECT ` + bookColumns + `
+		FROM books
+		INNER JOIN works ON works.id = books.work_id
+		WHERE books.work_id = $1
+		AND books.deleted_at IS NULL
+		ORDER BY (books.id = works.preferred_edition_id) DESC NULLS LAST, books.publication_date ASC, books.id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+		err := rows.Scan(book.fields()...)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// AttachEdition makes a book an edition of the work, moving it away from
+// any work it belonged to before.
+func (m WorkModel) AttachEdition(workID, bookID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE works
+		SET preferred_edition_id = NULL
+		WHERE preferred_edition_id = $1 AND id <> $2`
+
+	_, err = tx.ExecContext(ctx, query, bookID, workID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE books SET work_id = $1 WHERE id = $2 AND deleted_at IS NULL`, workID, bookID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (m WorkModel) DetachEdition(workID, bookID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE books SET work_id = NULL WHERE id = $1 AND work_id = $2`, bookID, workID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotAnEdition
+	}
+
+	query := `
+		UPDATE works
+		SET preferred_edition_id = NULL
+		WHERE id = $1 AND preferred_edition_id = $2`
+
+	_, err = tx.ExecContext(ctx, query, workID, bookID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetPreferredEdition picks the edition shown when the work is listed.
+func (m WorkModel) SetPreferredEdition(workID, bookID int64) error {
+	query := `
+		UPDATE works
+		SET preferred_edition_id = $2
+		WHERE id = $1
+		AND EXISTS (SELECT 1 FROM books WHERE books.id = $2 AND books.work_id = $1 AND books.deleted_at IS NULL)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, workID, bookID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotAnEdition
+	}
+
+	return nil
+}
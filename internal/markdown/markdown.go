@@ -0,0 +1,515 @@
+// Package markdown renders the restricted Markdown dialect accepted in
+// reviews to HTML that is safe to embed in any page.
+//
+// The dialect has paragraphs, block quotes, bulleted and numbered lists,
+// *emphasis*, **strong emphasis**, [links](https://example.com) and the
+// [spoiler]...[/spoiler] markup. Anything else, raw HTML included, is shown
+// as the text it was written as. Every character of the source is escaped,
+// so the only tags in the output are the ones the renderer writes itself.
+package markdown
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Version identifies the HTML the renderer produces. Bump it whenever the
+// output for the same source changes, so stored renderings are redone.
+const Version = 1
+
+// maxDepth bounds how deeply quotes, lists and emphasis may nest. Markup
+// nested deeper is shown as text.
+const maxDepth = 8
+
+// Render converts source to sanitized HTML.
+func Render(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+
+	var b strings.Builder
+	renderBlocks(&b, parseBlocks(strings.Split(source, "\n"), 0), false)
+	return b.String()
+}
+
+type blockKind int
+
+const (
+	paragraph blockKind = iota
+	quote
+	list
+)
+
+type block struct {
+	kind     blockKind
+	text     string    // paragraph
+	children []block   // quote
+	ordered  bool      // list
+	start    int       // list
+	items    [][]block // list
+}
+
+func parseBlocks(lines []string, depth int) []block {
+	var blocks []block
+
+	for i := 0; i < len(lines); {
+		line := expandTabs(lines[i])
+		if isBlank(line) {
+			i++
+			continue
+		}
+
+		if depth < maxDepth {
+			if _, ok := quoteLine(line); ok {
+				var inner []string
+				for ; i < len(lines); i++ {
+					rest, ok := quoteLine(expandTabs(lines[i]))
+					if !ok {
+						break
+					}
+					inner = append(inner, rest)
+				}
+				blocks = append(blocks, block{kind: quote, children: parseBlocks(inner, depth+1)})
+				continue
+			}
+
+			if m, ok := listMarker(line); ok {
+				var l block
+				l, i = parseList(lines, i, m, depth)
+				blocks = append(blocks, l)
+				continue
+			}
+		}
+
+		var text []string
+		for ; i < len(lines); i++ {
+			line := expandTabs(lines[i])
+			if isBlank(line) || (len(text) > 0 && depth < maxDepth && interruptsParagraph(line)) {
+				break
+			}
+			text = append(text, strings.TrimSpace(line))
+		}
+		blocks = append(blocks, block{kind: paragraph, text: strings.Join(text, "\n")})
+	}
+
+	return blocks
+}
+
+// parseList reads the list starting at lines[i] and returns it with the
+// index of the first line after it. An item runs on over lines indented past
+// its marker and over unindented lines that continue its text.
+func parseList(lines []string, i int, first marker, depth int) (block, int) {
+	l := block{kind: list, ordered: first.ordered, start: first.start}
+
+	m := first
+	item := []string{expandTabs(lines[i])[m.width:]}
+	for i++; i < len(lines); i++ {
+		line := expandTabs(lines[i])
+
+		if isBlank(line) {
+			// A blank line only continues the list if what follows it does.
+			j := i + 1
+			for j < len(lines) && isBlank(lines[j]) {
+				j++
+			}
+			if j == len(lines) {
+				break
+			}
+			next := expandTabs(lines[j])
+			nm, ok := listMarker(next)
+			if leadingSpaces(next) < m.width && !(ok && nm.sameList(first)) {
+				break
+			}
+			item = append(item, "")
+			continue
+		}
+
+		if nm, ok := listMarker(line); ok && nm.sameList(first) && leadingSpaces(line) < m.width {
+			l.items = append(l.items, parseBlocks(item, depth+1))
+			m = nm
+			item = []string{line[m.width:]}
+			continue
+		}
+
+		if leadingSpaces(line) >= m.width {
+			item = append(item, line[m.width:])
+			continue
+		}
+
+		if _, ok := quoteLine(line); ok {
+			break
+		}
+		if _, ok := listMarker(line); ok {
+			break
+		}
+		item = append(item, line)
+	}
+
+	l.items = append(l.items, parseBlocks(item, depth+1))
+	return l, i
+}
+
+// quoteLine reports whether line is part of a block quote and returns it
+// without the quote marker.
+func quoteLine(line string) (string, bool) {
+	indent := leadingSpaces(line)
+	if indent > 3 || indent == len(line) || line[indent] != '>' {
+		return "", false
+	}
+	rest := line[indent+1:]
+	return strings.TrimPrefix(rest, " "), true
+}
+
+type marker struct {
+	ordered bool
+	char    byte // the bullet, or the delimiter after the number
+	start   int
+	width   int // columns taken by the indent, the marker and one space
+}
+
+func (m marker) sameList(other marker) bool {
+	return m.ordered == other.ordered && m.char == other.char
+}
+
+// listMarker reports whether line starts a list item: "-", "*" or "+", or a
+// number followed by "." or ")", then a space. Numbers have at most three
+// digits, so a line opening with a year is not taken for a list.
+func listMarker(line string) (marker, bool) {
+	indent := leadingSpaces(line)
+	if indent > 3 {
+		return marker{}, false
+	}
+	t := line[indent:]
+
+	if len(t) >= 2 && strings.IndexByte("-*+", t[0]) >= 0 && t[1] == ' ' {
+		return marker{char: t[0], width: indent + 2}, true
+	}
+
+	n := 0
+	for n < len(t) && n < 3 && t[n] >= '0' && t[n] <= '9' {
+		n++
+	}
+	if n > 0 && n+1 < len(t) && (t[n] == '.' || t[n] == ')') && t[n+1] == ' ' {
+		start, _ := strconv.Atoi(t[:n])
+		return marker{ordered: true, char: t[n], start: start, width: indent + n + 2}, true
+	}
+
+	return marker{}, false
+}
+
+// interruptsParagraph reports whether line ends the paragraph before it. As
+// in CommonMark, only a numbered list starting at 1 does, so a sentence that
+// happens to wrap before a number is left alone.
+func interruptsParagraph(line string) bool {
+	if _, ok := quoteLine(line); ok {
+		return true
+	}
+	m, ok := listMarker(line)
+	return ok && (!m.ordered || m.start == 1)
+}
+
+func renderBlocks(b *strings.Builder, blocks []block, tight bool) {
+	for _, bl := range blocks {
+		switch bl.kind {
+		case paragraph:
+			if tight {
+				renderInline(b, bl.text, 0, false)
+			} else {
+				b.WriteString("<p>")
+				renderInline(b, bl.text, 0, false)
+				b.WriteString("</p>\n")
+			}
+		case quote:
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, bl.children, false)
+			b.WriteString("</blockquote>\n")
+		case list:
+			tag := "ul"
+			if bl.ordered {
+				tag = "ol"
+			}
+			if bl.ordered && bl.start != 1 {
+				fmt.Fprintf(b, "<ol start=\"%d\">\n", bl.start)
+			} else {
+				b.WriteString("<" + tag + ">\n")
+			}
+			for _, item := range bl.items {
+				b.WriteString("<li>")
+				renderBlocks(b, item, paragraphs(item) <= 1)
+				b.WriteString("</li>\n")
+			}
+			b.WriteString("</" + tag + ">\n")
+		}
+	}
+}
+
+func paragraphs(blocks []block) int {
+	n := 0
+	for _, bl := range blocks {
+		if bl.kind == paragraph {
+			n++
+		}
+	}
+	return n
+}
+
+// renderInline writes the text of a paragraph. Line breaks in the source are
+// kept. Links are not allowed inside links.
+func renderInline(b *strings.Builder, s string, depth int, inLink bool) {
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			writeEscaped(b, s[i+1:i+2])
+			i += 2
+			continue
+		case c == '\n':
+			b.WriteString("<br>\n")
+			i++
+			continue
+		case depth < maxDepth && (c == '*' || c == '_'):
+			if n := renderEmphasis(b, s, i, depth, inLink); n > 0 {
+				i += n
+				continue
+			}
+		case depth < maxDepth && c == '[':
+			if n := renderSpoiler(b, s, i, depth, inLink); n > 0 {
+				i += n
+				continue
+			}
+			if !inLink {
+				if n := renderLink(b, s, i, depth); n > 0 {
+					i += n
+					continue
+				}
+			}
+		}
+
+		writeEscaped(b, s[i:i+1])
+		i++
+	}
+}
+
+// renderEmphasis writes the emphasis opened at s[i], if it is closed, and
+// returns the number of bytes it took up.
+func renderEmphasis(b *strings.Builder, s string, i, depth int, inLink bool) int {
+	d := s[i]
+	width := 1
+	if i+1 < len(s) && s[i+1] == d {
+		width = 2
+	}
+
+	open := i + width
+	if open >= len(s) || isSpace(s[open]) {
+		return 0
+	}
+	// Underscores inside words, as in snake_case, are not emphasis.
+	if d == '_' && i > 0 && isWordByte(s[i-1]) {
+		return 0
+	}
+
+	end := findCloser(s, open, d, width)
+	if end < 0 {
+		return 0
+	}
+
+	tag := "em"
+	if width == 2 {
+		tag = "strong"
+	}
+	b.WriteString("<" + tag + ">")
+	renderInline(b, s[open:end], depth+1, inLink)
+	b.WriteString("</" + tag + ">")
+
+	return end + width - i
+}
+
+// findCloser returns the index of the delimiter closing emphasis whose text
+// starts at s[from], or -1 if there is none.
+func findCloser(s string, from int, d byte, width int) int {
+	for j := from; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if s[j] != d {
+			continue
+		}
+
+		run := 1
+		for j+run < len(s) && s[j+run] == d {
+			run++
+		}
+
+		// A pair of delimiters inside single emphasis belongs to strong
+		// emphasis nested in it.
+		if !(width == 1 && run == 2) && run >= width && j > from && !isSpace(s[j-1]) {
+			after := j + run
+			if d != '_' || after >= len(s) || !isWordByte(s[after]) {
+				return j + run - width
+			}
+		}
+		j += run - 1
+	}
+	return -1
+}
+
+const (
+	spoilerOpen  = "[spoiler]"
+	spoilerClose = "[/spoiler]"
+)
+
+// renderSpoiler writes the spoiler range opened at s[i], if it is closed, and
+// returns the number of bytes it took up.
+func renderSpoiler(b *strings.Builder, s string, i, depth int, inLink bool) int {
+	if !hasPrefixFold(s[i:], spoilerOpen) {
+		return 0
+	}
+
+	start := i + len(spoilerOpen)
+	end := -1
+	for j := start; j+len(spoilerClose) <= len(s); j++ {
+		if hasPrefixFold(s[j:], spoilerClose) {
+			end = j
+			break
+		}
+	}
+	if end < 0 {
+		return 0
+	}
+
+	b.WriteString(`<span class="spoiler">`)
+	renderInline(b, s[start:end], depth+1, inLink)
+	b.WriteString("</span>")
+
+	return end + len(spoilerClose) - i
+}
+
+// renderLink writes the link [text](url) starting at s[i] and returns the
+// number of bytes it took up. A link to anything but an http, https or
+// mailto URL is written as its text alone.
+func renderLink(b *strings.Builder, s string, i, depth int) int {
+	textEnd := matching(s, i, '[', ']')
+	if textEnd < 0 || textEnd == i+1 || textEnd+1 >= len(s) || s[textEnd+1] != '(' {
+		return 0
+	}
+
+	urlEnd := matching(s, textEnd+1, '(', ')')
+	if urlEnd < 0 {
+		return 0
+	}
+	raw := s[textEnd+2 : urlEnd]
+	if raw == "" || strings.ContainsAny(raw, " \t\n") {
+		return 0
+	}
+
+	text := s[i+1 : textEnd]
+	href, ok := safeURL(raw)
+	if !ok {
+		renderInline(b, text, depth+1, true)
+		return urlEnd + 1 - i
+	}
+
+	b.WriteString(`<a href="`)
+	writeEscaped(b, href)
+	b.WriteString(`" rel="nofollow ugc">`)
+	renderInline(b, text, depth+1, true)
+	b.WriteString("</a>")
+
+	return urlEnd + 1 - i
+}
+
+// matching returns the index of the close bracket matching the open one at
+// s[i], or -1.
+func matching(s string, i int, open, close byte) int {
+	level := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case open:
+			level++
+		case close:
+			level--
+			if level == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+func safeURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return "", false
+		}
+	case "mailto":
+		if u.Opaque == "" {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+
+	return u.String(), true
+}
+
+var htmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&#34;",
+	"'", "&#39;",
+)
+
+func writeEscaped(b *strings.Builder, s string) {
+	htmlEscaper.WriteString(b, s)
+}
+
+func expandTabs(line string) string {
+	indent := 0
+	for indent < len(line) && line[indent] == '\t' {
+		indent++
+	}
+	if indent == 0 {
+		return line
+	}
+	return strings.Repeat("    ", indent) + line[indent:]
+}
+
+func leadingSpaces(line string) int {
+	n := 0
+	for n < len(line) && line[n] == ' ' {
+		n++
+	}
+	return n
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
@@ -0,0 +1,150 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type renderTest struct {
+	name   string
+	source string
+	want   string
+}
+
+func runRenderTests(t *testing.T, tests []renderTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.source)
+			if got != tt.want {
+				t.Errorf("Render(%q)\n got: %q\nwant: %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	runRenderTests(t, []renderTest{
+		{"script tag", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"event handler", "<img src=x onerror=alert(1)>", "<p>&lt;img src=x onerror=alert(1)&gt;</p>\n"},
+		{"entities", "&lt;script&gt;", "<p>&amp;lt;script&amp;gt;</p>\n"},
+		{"in quote", "> <script>", "<blockquote>\n<p>&lt;script&gt;</p>\n</blockquote>\n"},
+		{"in list", "- <b>x</b>", "<ul>\n<li>&lt;b&gt;x&lt;/b&gt;</li>\n</ul>\n"},
+		{"in spoiler", "[spoiler]<i>[/spoiler]", "<p><span class=\"spoiler\">&lt;i&gt;</span></p>\n"},
+		{"in link text", "[<b>](https://a.example)", "<p><a href=\"https://a.example\" rel=\"nofollow ugc\">&lt;b&gt;</a></p>\n"},
+		{"after link", "[x](https://a.example)\"><script>", "<p><a href=\"https://a.example\" rel=\"nofollow ugc\">x</a>&#34;&gt;&lt;script&gt;</p>\n"},
+		{"quote in href", "[x](https://a.example/'onclick='x)", "<p><a href=\"https://a.example/&#39;onclick=&#39;x\" rel=\"nofollow ugc\">x</a></p>\n"},
+		{"double quote in href", "[x](https://a.example/\"onmouseover=\"alert(1))", "<p><a href=\"https://a.example/%22onmouseover=%22alert%281%29\" rel=\"nofollow ugc\">x</a></p>\n"},
+		{"markup in query", "[a](https://a.example?q=<b>)", "<p><a href=\"https://a.example?q=&lt;b&gt;\" rel=\"nofollow ugc\">a</a></p>\n"},
+	})
+}
+
+func TestRenderLinks(t *testing.T) {
+	runRenderTests(t, []renderTest{
+		{"https", "[x](https://example.com)", "<p><a href=\"https://example.com\" rel=\"nofollow ugc\">x</a></p>\n"},
+		{"ampersand", "[x](https://example.com/a?b=1&c=2)", "<p><a href=\"https://example.com/a?b=1&amp;c=2\" rel=\"nofollow ugc\">x</a></p>\n"},
+		{"mailto", "[mail](mailto:me@example.com)", "<p><a href=\"mailto:me@example.com\" rel=\"nofollow ugc\">mail</a></p>\n"},
+		{"formatted text", "[**bold**](https://example.com)", "<p><a href=\"https://example.com\" rel=\"nofollow ugc\"><strong>bold</strong></a></p>\n"},
+		{"no nested links", "[outer [inner](https://b.example)](https://a.example)", "<p><a href=\"https://a.example\" rel=\"nofollow ugc\">outer [inner](https://b.example)</a></p>\n"},
+		{"javascript", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"javascript upper case", "[x](JAVASCRIPT:alert(1))", "<p>x</p>\n"},
+		{"javascript entity", "[x](&#106;avascript:alert(1))", "<p>x</p>\n"},
+		{"javascript with space", "[x]( javascript:alert(1))", "<p>[x]( javascript:alert(1))</p>\n"},
+		{"javascript with tab", "[x](java\tscript:alert(1))", "<p>[x](java\tscript:alert(1))</p>\n"},
+		{"data", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>\n"},
+		{"vbscript", "[x](vbscript:msgbox)", "<p>x</p>\n"},
+		{"scheme relative", "[x](//evil.example)", "<p>x</p>\n"},
+		{"no host", "[x](http:///path)", "<p>x</p>\n"},
+		{"empty mailto", "[x](mailto:)", "<p>x</p>\n"},
+	})
+}
+
+func TestRenderBlocks(t *testing.T) {
+	runRenderTests(t, []renderTest{
+		{"empty", "", ""},
+		{"line break", "a\nb", "<p>a<br>\nb</p>\n"},
+		{"carriage returns", "a\r\nb\rc", "<p>a<br>\nb<br>\nc</p>\n"},
+		{"emphasis", "*em* and **strong** and snake_case_name", "<p><em>em</em> and <strong>strong</strong> and snake_case_name</p>\n"},
+		{"nested emphasis", "*a **b** c*", "<p><em>a <strong>b</strong> c</em></p>\n"},
+		{"escaped emphasis", `\*not em\*`, "<p>*not em*</p>\n"},
+		{"bulleted list", "- one\n- two", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"},
+		{"loose list", "- one\n\n- two", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"},
+		{"numbered list", "1. one\n2. two", "<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n"},
+		{"numbered list start", "3. three\n4. four", "<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n"},
+		{"item paragraphs", "1. a\n\n   b\n2. c", "<ol>\n<li><p>a</p>\n<p>b</p>\n</li>\n<li>c</li>\n</ol>\n"},
+		{"nested list", "- a\n  - b", "<ul>\n<li>a<ul>\n<li>b</li>\n</ul>\n</li>\n</ul>\n"},
+		{"year is not a list", "2024. was a year", "<p>2024. was a year</p>\n"},
+		{"wrapped number", "text\n2. not a list", "<p>text<br>\n2. not a list</p>\n"},
+		{"list after text", "text\n1. a list", "<p>text</p>\n<ol>\n<li>a list</li>\n</ol>\n"},
+		{"quote", "> quoted\n> more", "<blockquote>\n<p>quoted<br>\nmore</p>\n</blockquote>\n"},
+		{"list in quote", "> - a\n> - b", "<blockquote>\n<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n</blockquote>\n"},
+		{"spoiler", "it was [spoiler]the butler[/spoiler] all along", "<p>it was <span class=\"spoiler\">the butler</span> all along</p>\n"},
+		{"spoiler any case", "[SPOILER]x[/Spoiler]", "<p><span class=\"spoiler\">x</span></p>\n"},
+		{"unclosed spoiler", "[spoiler]unclosed", "<p>[spoiler]unclosed</p>\n"},
+	})
+}
+
+func TestRenderNestingLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		tag    string
+	}{
+		{"quotes", strings.Repeat(">", 20) + " deep", "<blockquote>"},
+		{"spaced quotes", strings.Repeat("> ", 10000) + "deep", "<blockquote>"},
+		{"lists", nestedList(20), "<ul>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.source)
+			if n := strings.Count(got, tt.tag); n != maxDepth {
+				t.Errorf("got %d %s tags, want %d", n, tt.tag, maxDepth)
+			}
+			if !strings.Contains(got, "deep") {
+				t.Errorf("text past the nesting limit was dropped: %q", got)
+			}
+		})
+	}
+}
+
+func nestedList(depth int) string {
+	var b strings.Builder
+	for i := 0; i < depth; i++ {
+		b.WriteString(strings.Repeat("  ", i) + "- item\n")
+	}
+	b.WriteString(strings.Repeat("  ", depth) + "- deep\n")
+	return b.String()
+}
+
+// allowedTag matches every tag the renderer may write.
+var allowedTag = regexp.MustCompile(`^<(/?(p|blockquote|ul|ol|li|em|strong|span|a)|br|ol start="\d+"|span class="spoiler"|a href="[^"<>]*" rel="nofollow ugc")>$`)
+
+var tagRX = regexp.MustCompile(`<[^>]*>`)
+
+func TestRenderWritesOnlyAllowedTags(t *testing.T) {
+	sources := []string{
+		"<script>alert(1)</script>",
+		"<a href=\"javascript:alert(1)\">x</a>",
+		"<<script>script>",
+		"[x](javascript:alert(1))",
+		"[x](https://a.example\"><script>alert(1)</script>)",
+		"[<img src=x onerror=alert(1)>](https://a.example)",
+		"[spoiler]<svg onload=alert(1)>[/spoiler]",
+		"> <iframe src=https://a.example>",
+		"- *<style>*\n- **</style>**",
+		"1) <object data=x>",
+		"*[spoiler]<b>*[/spoiler]*",
+	}
+
+	for _, source := range sources {
+		got := Render(source)
+		for _, tag := range tagRX.FindAllString(got, -1) {
+			if !allowedTag.MatchString(tag) {
+				t.Errorf("Render(%q) wrote tag %q", source, tag)
+			}
+		}
+	}
+}
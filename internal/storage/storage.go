@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Object is a stored blob opened for reading. Callers must Close it.
+type Object struct {
+	io.ReadSeekCloser
+	Size    int64
+	ModTime time.Time
+}
+
+// Store keeps blobs under slash-separated keys such as
+// "covers/12/1f2e3d-large.jpg". Implementations must be safe for
+// concurrent use.
+type Store interface {
+	Put(key string, data []byte) error
+	Get(key string) (*Object, error)
+	Delete(key string) error
+}
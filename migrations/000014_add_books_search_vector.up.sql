@@ -0,0 +1,24 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION books_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(array_to_string(NEW.authors, ' '), '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(NEW.genre, '')), 'C') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER books_search_vector_trigger
+BEFORE INSERT OR UPDATE OF title, authors, genre, description ON books
+FOR EACH ROW EXECUTE FUNCTION books_search_vector_update();
+
+UPDATE books SET search_vector =
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(array_to_string(authors, ' '), '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(genre, '')), 'C') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'D');
+
+CREATE INDEX IF NOT EXISTS books_search_vector_idx ON books USING GIN (search_vector);
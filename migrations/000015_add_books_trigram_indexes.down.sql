@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS books_authors_trgm_idx;
+
+DROP INDEX IF EXISTS books_title_trgm_idx;
+
+DROP FUNCTION IF EXISTS books_authors_text(TEXT[]);
@@ -0,0 +1,10 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- array_to_string is only STABLE, so wrap it to make the authors expression indexable
+CREATE OR REPLACE FUNCTION books_authors_text(authors TEXT[]) RETURNS TEXT AS $$
+    SELECT array_to_string(authors, ' ')
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS books_title_trgm_idx ON books USING GIN (title gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS books_authors_trgm_idx ON books USING GIN (books_authors_text(authors) gin_trgm_ops);
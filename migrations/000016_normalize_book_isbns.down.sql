@@ -0,0 +1 @@
+-- The original ISBN spellings are not kept, so there is nothing to restore.
@@ -0,0 +1,45 @@
+-- Strip hyphens/spaces and convert ISBN-10s to ISBN-13, as NormalizeISBN
+-- does. Only ISBNs with a correct check digit are converted; anything else
+-- is left as it is and is reported by validation when the book is next
+-- edited. Several spellings of the same ISBN may share a canonical form, so
+-- only the oldest book with that form is converted, and none is if another
+-- book already has it.
+WITH cleaned AS (
+    SELECT id, upper(regexp_replace(isbn, '[- ]', '', 'g')) AS digits
+    FROM books
+), valid AS (
+    SELECT id, digits
+    FROM cleaned
+    WHERE CASE
+        WHEN digits ~ '^[0-9]{9}[0-9X]$' THEN (
+            SELECT SUM(CASE WHEN substr(digits, i, 1) = 'X' THEN 10 ELSE substr(digits, i, 1)::int END * (11 - i))
+            FROM generate_series(1, 10) AS i
+        ) % 11 = 0
+        WHEN digits ~ '^[0-9]{13}$' THEN (
+            SELECT SUM(substr(digits, i, 1)::int * CASE WHEN i % 2 = 0 THEN 3 ELSE 1 END)
+            FROM generate_series(1, 13) AS i
+        ) % 10 = 0
+        ELSE false
+    END
+), converted AS (
+    SELECT id,
+        CASE WHEN length(digits) = 10 THEN
+            '978' || left(digits, 9) || ((10 - (
+                SELECT SUM(substr('978' || left(digits, 9), i, 1)::int * CASE WHEN i % 2 = 0 THEN 3 ELSE 1 END)
+                FROM generate_series(1, 12) AS i
+            ) % 10) % 10)::text
+        ELSE digits END AS isbn
+    FROM valid
+), changed AS (
+    SELECT converted.id, converted.isbn,
+        ROW_NUMBER() OVER (PARTITION BY converted.isbn ORDER BY converted.id) AS rank
+    FROM converted
+    JOIN books ON books.id = converted.id
+    WHERE books.isbn <> converted.isbn
+)
+UPDATE books
+SET isbn = changed.isbn
+FROM changed
+WHERE books.id = changed.id
+AND changed.rank = 1
+AND NOT EXISTS (SELECT 1 FROM books other WHERE other.isbn = changed.isbn);
@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS authors (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    -- "J.R.R. Tolkien" and "J. R. R. Tolkien" share a key, so they are one author
+    name_key text GENERATED ALWAYS AS (lower(regexp_replace(name, '[^[:alnum:]]+', '', 'g'))) STORED,
+    bio text NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS authors_name_key_idx ON authors (name_key);
+
+CREATE TABLE IF NOT EXISTS book_authors (
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    author_id bigint NOT NULL REFERENCES authors(id) ON DELETE RESTRICT,
+    role text NOT NULL DEFAULT 'author' CHECK (role IN ('author', 'editor', 'translator', 'illustrator')),
+    position integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, author_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS book_authors_author_id_idx ON book_authors (author_id);
+
+-- One author per normalized name, keeping the first spelling we come across
+INSERT INTO authors (name)
+SELECT DISTINCT ON (lower(regexp_replace(a.name, '[^[:alnum:]]+', '', 'g'))) trim(a.name)
+FROM books
+CROSS JOIN LATERAL unnest(books.authors) WITH ORDINALITY AS a(name, ord)
+WHERE regexp_replace(a.name, '[^[:alnum:]]+', '', 'g') <> ''
+ORDER BY lower(regexp_replace(a.name, '[^[:alnum:]]+', '', 'g')), books.id, a.ord
+ON CONFLICT DO NOTHING;
+
+INSERT INTO book_authors (book_id, author_id, role, position)
+SELECT books.id, authors.id, 'author', MIN(a.ord) - 1
+FROM books
+CROSS JOIN LATERAL unnest(books.authors) WITH ORDINALITY AS a(name, ord)
+JOIN authors ON authors.name_key = lower(regexp_replace(a.name, '[^[:alnum:]]+', '', 'g'))
+GROUP BY books.id, authors.id
+ON CONFLICT DO NOTHING;
+
+-- Rewrite the arrays with the canonical spellings, which also drops duplicates
+UPDATE books
+SET authors = (
+    SELECT array_agg(authors.name ORDER BY book_authors.position)
+    FROM book_authors
+    JOIN authors ON authors.id = book_authors.author_id
+    WHERE book_authors.book_id = books.id
+    AND book_authors.role = 'author'
+)
+WHERE EXISTS (SELECT 1 FROM book_authors WHERE book_authors.book_id = books.id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS books_work_id_idx;
+
+ALTER TABLE books DROP COLUMN IF EXISTS language;
+ALTER TABLE books DROP COLUMN IF EXISTS format;
+ALTER TABLE books DROP COLUMN IF EXISTS work_id;
+
+DROP TABLE IF EXISTS works;
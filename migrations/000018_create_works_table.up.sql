@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS works (
+    id bigserial PRIMARY KEY,
+    title text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    preferred_edition_id INT REFERENCES books(id) ON DELETE SET NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS work_id bigint REFERENCES works(id) ON DELETE SET NULL;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS format text NOT NULL DEFAULT ''
+    CHECK (format IN ('', 'hardcover', 'paperback', 'ebook', 'audiobook'));
+ALTER TABLE books ADD COLUMN IF NOT EXISTS language text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS books_work_id_idx ON books (work_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS series_books;
+
+DROP TABLE IF EXISTS series;
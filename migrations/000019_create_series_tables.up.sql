@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS series (
+    id bigserial PRIMARY KEY,
+    title text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+-- A book belongs to at most one series. Positions are fractional so a
+-- novella can sit between two novels at 2.5.
+CREATE TABLE IF NOT EXISTS series_books (
+    book_id INT PRIMARY KEY REFERENCES books(id) ON DELETE CASCADE,
+    series_id bigint NOT NULL REFERENCES series(id) ON DELETE CASCADE,
+    position NUMERIC(8, 2) NOT NULL CHECK (position > 0)
+);
+
+CREATE INDEX IF NOT EXISTS series_books_series_position_idx ON series_books (series_id, position);
@@ -0,0 +1,3 @@
+-- Short content hash of the current cover upload; empty when the book has
+-- no cover. The image files themselves live in the storage backend.
+ALTER TABLE books ADD COLUMN IF NOT EXISTS cover_hash text NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+-- Without soft deletion, anything still in the trash would come back, so
+-- finish deleting it first.
+DELETE FROM reviews WHERE deleted_at IS NOT NULL;
+DELETE FROM reading_lists WHERE deleted_at IS NOT NULL;
+DELETE FROM books WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS reading_lists_deleted_at_idx;
+DROP INDEX IF EXISTS reviews_deleted_at_idx;
+DROP INDEX IF EXISTS books_deleted_at_idx;
+
+DROP INDEX IF EXISTS books_isbn_key;
+ALTER TABLE books ADD CONSTRAINT books_isbn_key UNIQUE (isbn);
+
+ALTER TABLE reading_lists DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE reviews DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE books DROP COLUMN IF EXISTS deleted_at;
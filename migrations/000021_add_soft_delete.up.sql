@@ -0,0 +1,13 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) WITH TIME ZONE;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) WITH TIME ZONE;
+ALTER TABLE reading_lists ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) WITH TIME ZONE;
+
+-- A book in the trash must not block a new book with the same ISBN, so
+-- uniqueness only covers live rows. The index keeps the constraint's name,
+-- which is what duplicate key errors report.
+ALTER TABLE books DROP CONSTRAINT IF EXISTS books_isbn_key;
+CREATE UNIQUE INDEX IF NOT EXISTS books_isbn_key ON books (isbn) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS books_deleted_at_idx ON books (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS reviews_deleted_at_idx ON reviews (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS reading_lists_deleted_at_idx ON reading_lists (deleted_at) WHERE deleted_at IS NOT NULL;
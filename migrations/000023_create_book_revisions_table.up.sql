@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS book_revisions (
+    id bigserial PRIMARY KEY,
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    version integer NOT NULL,
+    user_id bigint REFERENCES users(id) ON DELETE SET NULL,
+    snapshot jsonb NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (book_id, version)
+);
+
+-- History is append-only. Rows only go away with their book when the trash
+-- is purged.
+CREATE OR REPLACE FUNCTION book_revisions_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'book_revisions is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS book_revisions_immutable ON book_revisions;
+CREATE TRIGGER book_revisions_immutable BEFORE UPDATE ON book_revisions
+    FOR EACH ROW EXECUTE FUNCTION book_revisions_immutable();
+
+-- Existing books start their history at their current version, with no
+-- known editor.
+INSERT INTO book_revisions (book_id, version, snapshot, created_at)
+SELECT books.id, books.version, jsonb_build_object(
+        'title', books.title,
+        'authors', to_jsonb(books.authors),
+        'isbn', books.isbn,
+        'publication_date', to_char(books.publication_date, 'YYYY-MM-DD'),
+        'genre', COALESCE(books.genre, ''),
+        'description', COALESCE(books.description, ''),
+        'format', books.format,
+        'language', books.language,
+        'contributors', COALESCE((
+            SELECT jsonb_agg(jsonb_build_object(
+                    'author_id', authors.id,
+                    'name', authors.name,
+                    'role', book_authors.role,
+                    'position', book_authors.position
+                ) ORDER BY book_authors.position, authors.id)
+            FROM book_authors
+            INNER JOIN authors ON authors.id = book_authors.author_id
+            WHERE book_authors.book_id = books.id
+        ), '[]'::jsonb)
+    ), books.created_at
+FROM books
+ON CONFLICT (book_id, version) DO NOTHING;
@@ -0,0 +1,13 @@
+DROP TRIGGER IF EXISTS authors_touch_books ON authors;
+DROP TRIGGER IF EXISTS series_touch_books ON series;
+DROP TRIGGER IF EXISTS series_books_touch_books ON series_books;
+DROP TRIGGER IF EXISTS reviews_set_updated_at ON reviews;
+DROP TRIGGER IF EXISTS books_set_updated_at ON books;
+
+DROP FUNCTION IF EXISTS touch_authors();
+DROP FUNCTION IF EXISTS touch_series();
+DROP FUNCTION IF EXISTS touch_series_books();
+DROP FUNCTION IF EXISTS set_updated_at();
+
+ALTER TABLE reviews DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE books DROP COLUMN IF EXISTS updated_at;
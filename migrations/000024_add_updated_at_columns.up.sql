@@ -0,0 +1,67 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS updated_at timestamp WITH TIME ZONE NOT NULL DEFAULT NOW();
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS updated_at timestamp WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+UPDATE books SET updated_at = created_at;
+UPDATE reviews SET updated_at = created_at;
+
+-- updated_at backs Last-Modified and the ETags of books and reviews, so it
+-- must move whenever anything shown in their representation changes, not
+-- just when the version is bumped.
+CREATE OR REPLACE FUNCTION set_updated_at() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS books_set_updated_at ON books;
+CREATE TRIGGER books_set_updated_at BEFORE UPDATE ON books
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+DROP TRIGGER IF EXISTS reviews_set_updated_at ON reviews;
+CREATE TRIGGER reviews_set_updated_at BEFORE UPDATE ON reviews
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- A book also shows its contributors' names and its series, which live in
+-- other tables.
+CREATE OR REPLACE FUNCTION touch_series_books() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE books SET updated_at = NOW() WHERE id = OLD.book_id;
+        RETURN OLD;
+    END IF;
+    UPDATE books SET updated_at = NOW() WHERE id = NEW.book_id;
+    IF TG_OP = 'UPDATE' AND OLD.book_id <> NEW.book_id THEN
+        UPDATE books SET updated_at = NOW() WHERE id = OLD.book_id;
+    END IF;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS series_books_touch_books ON series_books;
+CREATE TRIGGER series_books_touch_books AFTER INSERT OR UPDATE OR DELETE ON series_books
+    FOR EACH ROW EXECUTE FUNCTION touch_series_books();
+
+CREATE OR REPLACE FUNCTION touch_series() RETURNS trigger AS $$
+BEGIN
+    UPDATE books SET updated_at = NOW()
+    WHERE id IN (SELECT book_id FROM series_books WHERE series_id = NEW.id);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS series_touch_books ON series;
+CREATE TRIGGER series_touch_books AFTER UPDATE OF title ON series
+    FOR EACH ROW EXECUTE FUNCTION touch_series();
+
+CREATE OR REPLACE FUNCTION touch_authors() RETURNS trigger AS $$
+BEGIN
+    UPDATE books SET updated_at = NOW()
+    WHERE id IN (SELECT book_id FROM book_authors WHERE author_id = NEW.id);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS authors_touch_books ON authors;
+CREATE TRIGGER authors_touch_books AFTER UPDATE OF name ON authors
+    FOR EACH ROW EXECUTE FUNCTION touch_authors();
@@ -0,0 +1,2 @@
+DELETE FROM permissions
+WHERE code = 'metrics:read';
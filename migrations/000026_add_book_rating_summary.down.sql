@@ -0,0 +1,4 @@
+ALTER TABLE books DROP COLUMN IF EXISTS weighted_rating;
+ALTER TABLE books ALTER COLUMN average_rating DROP NOT NULL;
+ALTER TABLE books DROP COLUMN IF EXISTS rating_histogram;
+ALTER TABLE books DROP COLUMN IF EXISTS ratings_count;
@@ -0,0 +1,30 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS ratings_count integer NOT NULL DEFAULT 0;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS rating_histogram integer[] NOT NULL DEFAULT '{0,0,0,0,0}';
+
+UPDATE books
+SET ratings_count = stats.count, average_rating = stats.average, rating_histogram = stats.histogram
+FROM (
+    SELECT books.id AS book_id,
+        COUNT(reviews.id) AS count,
+        COALESCE(AVG(reviews.rating), 0) AS average,
+        ARRAY[
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 1),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 2),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 3),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 4),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 5)
+        ]::integer[] AS histogram
+    FROM books
+    LEFT JOIN reviews ON reviews.book_id = books.id AND reviews.deleted_at IS NULL
+    GROUP BY books.id
+) AS stats
+WHERE books.id = stats.book_id;
+
+ALTER TABLE books ALTER COLUMN average_rating SET NOT NULL;
+
+-- The weighted rating pulls the average towards a prior of five 3-star
+-- ratings, so a book needs a number of good reviews to outrank one with
+-- many slightly worse ones. The prior is fixed rather than the catalog
+-- mean so the column never depends on other books.
+ALTER TABLE books ADD COLUMN IF NOT EXISTS weighted_rating double precision
+    GENERATED ALWAYS AS ((average_rating * ratings_count + 3 * 5) / (ratings_count + 5)) STORED;
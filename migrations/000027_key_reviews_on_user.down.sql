@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS reviews_book_id_user_id_key;
+
+-- Bring back the author column, filled in from each reviewer's current
+-- username. Duplicate reviews trashed by the up migration stay in the trash.
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS author TEXT;
+
+UPDATE reviews
+SET author = users.username
+FROM users
+WHERE users.id = reviews.user_id;
+
+ALTER TABLE reviews ALTER COLUMN author SET NOT NULL;
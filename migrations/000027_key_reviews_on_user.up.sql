@@ -0,0 +1,37 @@
+-- Reviews belong to a user, not to whoever shares their username.
+ALTER TABLE reviews DROP COLUMN IF EXISTS author;
+
+-- Keep each user's most recent review of a book. Older duplicates go to the
+-- trash rather than being deleted outright.
+UPDATE reviews
+SET deleted_at = NOW()
+WHERE deleted_at IS NULL
+AND EXISTS (
+    SELECT 1 FROM reviews AS newer
+    WHERE newer.book_id = reviews.book_id
+    AND newer.user_id = reviews.user_id
+    AND newer.deleted_at IS NULL
+    AND (newer.created_at, newer.id) > (reviews.created_at, reviews.id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS reviews_book_id_user_id_key ON reviews (book_id, user_id)
+    WHERE deleted_at IS NULL;
+
+UPDATE books
+SET ratings_count = stats.count, average_rating = stats.average, rating_histogram = stats.histogram
+FROM (
+    SELECT books.id AS book_id,
+        COUNT(reviews.id) AS count,
+        COALESCE(AVG(reviews.rating), 0) AS average,
+        ARRAY[
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 1),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 2),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 3),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 4),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 5)
+        ]::integer[] AS histogram
+    FROM books
+    LEFT JOIN reviews ON reviews.book_id = books.id AND reviews.deleted_at IS NULL
+    GROUP BY books.id
+) AS stats
+WHERE books.id = stats.book_id AND books.ratings_count <> stats.count;
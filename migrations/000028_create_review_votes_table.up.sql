@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS review_votes (
+    review_id INT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    value smallint NOT NULL CHECK (value IN (-1, 1)),
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (review_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS review_votes_user_id_idx ON review_votes (user_id);
+
+-- helpful_count is now the net of the recorded votes. Counts set by hand
+-- before there were votes are discarded.
+UPDATE reviews SET helpful_count = 0 WHERE helpful_count IS DISTINCT FROM 0;
+ALTER TABLE reviews ALTER COLUMN helpful_count SET NOT NULL;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS review_comments (
+    id bigserial PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    parent_id bigint REFERENCES review_comments(id) ON DELETE CASCADE,
+    -- root_id is the top-level comment of the thread, NULL on top-level
+    -- comments themselves, so a whole thread loads in one query.
+    root_id bigint REFERENCES review_comments(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content text NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at timestamp WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    deleted_at timestamp(0) WITH TIME ZONE,
+    version integer NOT NULL DEFAULT 1,
+    CHECK ((parent_id IS NULL) = (root_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS review_comments_review_id_idx ON review_comments (review_id) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS review_comments_root_id_idx ON review_comments (root_id);
+
+DROP TRIGGER IF EXISTS review_comments_set_updated_at ON review_comments;
+CREATE TRIGGER review_comments_set_updated_at BEFORE UPDATE ON review_comments
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
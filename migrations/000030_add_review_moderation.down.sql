@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS review_moderation_actions;
+DROP TABLE IF EXISTS review_reports;
+DROP INDEX IF EXISTS reviews_moderation_status_idx;
+ALTER TABLE reviews DROP COLUMN IF EXISTS moderation_status;
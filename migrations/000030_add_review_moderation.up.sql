@@ -0,0 +1,33 @@
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS moderation_status text NOT NULL DEFAULT 'visible'
+    CHECK (moderation_status IN ('visible', 'pending', 'hidden', 'removed'));
+
+CREATE INDEX IF NOT EXISTS reviews_moderation_status_idx ON reviews (moderation_status)
+    WHERE moderation_status <> 'visible';
+
+CREATE TABLE IF NOT EXISTS review_reports (
+    id bigserial PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason text NOT NULL,
+    details text NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    resolved_at timestamp(0) WITH TIME ZONE
+);
+
+-- A user has at most one open report per review. Once a moderator has dealt
+-- with it they may report the review again.
+CREATE UNIQUE INDEX IF NOT EXISTS review_reports_open_key ON review_reports (review_id, user_id)
+    WHERE resolved_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS review_moderation_actions (
+    id bigserial PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    moderator_id bigint REFERENCES users(id) ON DELETE SET NULL,
+    action text NOT NULL,
+    from_status text NOT NULL,
+    to_status text NOT NULL,
+    note text NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS review_moderation_actions_review_id_idx ON review_moderation_actions (review_id);
@@ -0,0 +1 @@
+INSERT INTO permissions (code) VALUES ('reviews:moderate');
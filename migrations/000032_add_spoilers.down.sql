@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS spoilers;
+ALTER TABLE reviews DROP COLUMN IF EXISTS contains_spoilers;
@@ -0,0 +1,6 @@
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS contains_spoilers boolean NOT NULL DEFAULT false;
+
+-- How spoilers in reviews are shown to the user when a request does not say.
+-- Showing them keeps the behaviour clients had before spoilers were marked.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS spoilers text NOT NULL DEFAULT 'show'
+    CHECK (spoilers IN ('hide', 'show'));
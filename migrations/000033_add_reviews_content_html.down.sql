@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS reviews_content_html_version_idx;
+ALTER TABLE reviews DROP COLUMN IF EXISTS content_html_version;
+ALTER TABLE reviews DROP COLUMN IF EXISTS content_html;
@@ -0,0 +1,7 @@
+-- content_html caches the review's Markdown rendered to sanitized HTML.
+-- Rows rendered by an older renderer, or not at all, have a lower
+-- content_html_version and are rendered again by the API server.
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS content_html text NOT NULL DEFAULT '';
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS content_html_version integer NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS reviews_content_html_version_idx ON reviews (content_html_version);
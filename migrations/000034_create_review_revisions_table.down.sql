@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS reviews_record_revision ON reviews;
+DROP FUNCTION IF EXISTS record_review_revision();
+DROP TABLE IF EXISTS review_revisions;
+ALTER TABLE reviews DROP COLUMN IF EXISTS revision_count;
+ALTER TABLE reviews DROP COLUMN IF EXISTS edited_at;
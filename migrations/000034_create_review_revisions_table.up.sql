@@ -0,0 +1,40 @@
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS edited_at timestamp WITH TIME ZONE;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS revision_count integer NOT NULL DEFAULT 0;
+
+-- Each row is a state a review had before an edit replaced it. written_at is
+-- when that state was saved and replaced_at when the edit replaced it.
+CREATE TABLE IF NOT EXISTS review_revisions (
+    id bigserial PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    version integer NOT NULL,
+    content text NOT NULL,
+    rating integer,
+    contains_spoilers boolean NOT NULL,
+    written_at timestamp WITH TIME ZONE NOT NULL,
+    replaced_at timestamp WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (review_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS review_revisions_replaced_at_idx ON review_revisions (replaced_at);
+
+-- Recording revisions in a trigger catches both ways a review is edited:
+-- updating it and posting a new review over it. Changes that leave the
+-- reviewer's words, rating and spoiler flag alone are not edits.
+CREATE OR REPLACE FUNCTION record_review_revision() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO review_revisions (review_id, version, content, rating, contains_spoilers, written_at)
+    VALUES (OLD.id, OLD.version, OLD.content, OLD.rating, OLD.contains_spoilers,
+        COALESCE(OLD.edited_at, OLD.created_at));
+    NEW.edited_at = NOW();
+    NEW.revision_count = OLD.revision_count + 1;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS reviews_record_revision ON reviews;
+CREATE TRIGGER reviews_record_revision BEFORE UPDATE ON reviews
+    FOR EACH ROW
+    WHEN (OLD.content IS DISTINCT FROM NEW.content
+        OR OLD.rating IS DISTINCT FROM NEW.rating
+        OR OLD.contains_spoilers IS DISTINCT FROM NEW.contains_spoilers)
+    EXECUTE FUNCTION record_review_revision();
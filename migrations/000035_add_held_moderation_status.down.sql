@@ -0,0 +1,26 @@
+UPDATE reviews SET moderation_status = 'pending' WHERE moderation_status = 'held';
+
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_moderation_status_check;
+ALTER TABLE reviews ADD CONSTRAINT reviews_moderation_status_check
+    CHECK (moderation_status IN ('visible', 'pending', 'hidden', 'removed'));
+
+-- The reviews that were held count towards ratings again.
+UPDATE books
+SET ratings_count = stats.count, average_rating = stats.average, rating_histogram = stats.histogram
+FROM (
+    SELECT books.id AS book_id,
+        COUNT(reviews.id) AS count,
+        COALESCE(AVG(reviews.rating), 0) AS average,
+        ARRAY[
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 1),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 2),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 3),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 4),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 5)
+        ]::integer[] AS histogram
+    FROM books
+    LEFT JOIN reviews ON reviews.book_id = books.id AND reviews.deleted_at IS NULL
+        AND reviews.moderation_status IN ('visible', 'pending')
+    GROUP BY books.id
+) AS stats
+WHERE books.id = stats.book_id AND books.rating_histogram <> stats.histogram;
@@ -0,0 +1,33 @@
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_moderation_status_check;
+ALTER TABLE reviews ADD CONSTRAINT reviews_moderation_status_check
+    CHECK (moderation_status IN ('visible', 'pending', 'held', 'hidden', 'removed'));
+
+-- Reviews held by the content filter used to be marked pending and stayed
+-- public. Pending reviews without enough open reports to have been put in
+-- the queue by readers were held by the filter.
+UPDATE reviews
+SET moderation_status = 'held'
+WHERE moderation_status = 'pending'
+AND (SELECT COUNT(*) FROM review_reports
+    WHERE review_reports.review_id = reviews.id AND resolved_at IS NULL) < 3;
+
+-- Held reviews no longer count towards their book's ratings.
+UPDATE books
+SET ratings_count = stats.count, average_rating = stats.average, rating_histogram = stats.histogram
+FROM (
+    SELECT books.id AS book_id,
+        COUNT(reviews.id) AS count,
+        COALESCE(AVG(reviews.rating), 0) AS average,
+        ARRAY[
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 1),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 2),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 3),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 4),
+            COUNT(reviews.id) FILTER (WHERE reviews.rating = 5)
+        ]::integer[] AS histogram
+    FROM books
+    LEFT JOIN reviews ON reviews.book_id = books.id AND reviews.deleted_at IS NULL
+        AND reviews.moderation_status IN ('visible', 'pending')
+    GROUP BY books.id
+) AS stats
+WHERE books.id = stats.book_id AND books.rating_histogram <> stats.histogram;
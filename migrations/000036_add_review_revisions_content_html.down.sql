@@ -0,0 +1,13 @@
+CREATE OR REPLACE FUNCTION record_review_revision() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO review_revisions (review_id, version, content, rating, contains_spoilers, written_at)
+    VALUES (OLD.id, OLD.version, OLD.content, OLD.rating, OLD.contains_spoilers,
+        COALESCE(OLD.edited_at, OLD.created_at));
+    NEW.edited_at = NOW();
+    NEW.revision_count = OLD.revision_count + 1;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE review_revisions DROP COLUMN IF EXISTS content_html_version;
+ALTER TABLE review_revisions DROP COLUMN IF EXISTS content_html;
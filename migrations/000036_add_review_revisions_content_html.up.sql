@@ -0,0 +1,16 @@
+-- Revisions keep the HTML their review had, like reviews themselves. Older
+-- revisions have content_html_version 0 and are rendered when read.
+ALTER TABLE review_revisions ADD COLUMN IF NOT EXISTS content_html text NOT NULL DEFAULT '';
+ALTER TABLE review_revisions ADD COLUMN IF NOT EXISTS content_html_version integer NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION record_review_revision() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO review_revisions (review_id, version, content, content_html, content_html_version,
+        rating, contains_spoilers, written_at)
+    VALUES (OLD.id, OLD.version, OLD.content, OLD.content_html, OLD.content_html_version,
+        OLD.rating, OLD.contains_spoilers, COALESCE(OLD.edited_at, OLD.created_at));
+    NEW.edited_at = NOW();
+    NEW.revision_count = OLD.revision_count + 1;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;